@@ -0,0 +1,422 @@
+package robotstxt
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// FullyDisallowedAgents returns, in sorted order, the agents whose group
+// disallows every path. For DisallowAll data it returns "*".
+func (r *RobotsData) FullyDisallowedAgents() []string {
+	if r.DisallowAll {
+		return []string{"*"}
+	}
+	var agents []string
+	for _, a := range r.agentNames() {
+		if r.Groups[a].disallowsAll() {
+			agents = append(agents, a)
+		}
+	}
+	return agents
+}
+
+// disallowsAll reports whether no path is allowed by g: a disallow rule
+// covers "/" and its descendants, and there is no allow rule to carve out
+// exceptions.
+func (g *Group) disallowsAll() bool {
+	for _, r := range g.Rules {
+		if r.Allow {
+			return false
+		}
+	}
+	rule := g.findRule("/")
+	return rule != nil && !strings.HasSuffix(rule.Path, "$")
+}
+
+// AgentsDisallowed returns, in sorted order, the declared agents whose group
+// disallows path. For DisallowAll data it returns "*".
+func (r *RobotsData) AgentsDisallowed(path string) []string {
+	if r.DisallowAll {
+		return []string{"*"}
+	}
+	var agents []string
+	for _, a := range r.agentNames() {
+		if !r.Groups[a].Test(path) {
+			agents = append(agents, a)
+		}
+	}
+	return agents
+}
+
+// Paths returns the distinct rule paths, including wildcard patterns as
+// written, of all groups in sorted order.
+func (r *RobotsData) Paths() []string {
+	seen := make(map[string]bool)
+	var paths []string
+	for _, g := range r.Groups {
+		for _, rule := range g.Rules {
+			if !seen[rule.Path] {
+				seen[rule.Path] = true
+				paths = append(paths, rule.Path)
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Classify tests each of urls for agent and counts the outcomes. urls may
+// be absolute URLs or paths, those that fail to parse count as errored.
+func (r *RobotsData) Classify(urls []string, agent string) (allowed, disallowed, errored int) {
+	g := r.FindGroup(agent)
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		switch {
+		case err != nil:
+			errored++
+		case r.AllowAll || !r.DisallowAll && g.Test(requestPath(u)):
+			allowed++
+		default:
+			disallowed++
+		}
+	}
+	return
+}
+
+// BlockedPrefixes returns, in sorted order, the paths and patterns of the
+// Disallow rules applying to agent that are not made redundant by a
+// broader Disallow rule, and that are not entirely undone by Allow rules.
+// A narrower Disallow is kept when an Allow rule in between re-allows part
+// of the broader one.
+func (r *RobotsData) BlockedPrefixes(agent string) []string {
+	if r.AllowAll {
+		return nil
+	}
+	if r.DisallowAll {
+		return []string{"/"}
+	}
+	g := r.FindGroup(agent)
+	var blocked []*Rule
+	for _, rule := range g.Rules {
+		if !rule.Allow && rule.Path != "" && g.shadowedBy(rule) == nil {
+			blocked = append(blocked, rule)
+		}
+	}
+
+	var prefixes []string
+	seen := make(map[string]bool)
+	for _, d := range blocked {
+		if !seen[d.Path] && !g.subsumed(d, blocked) {
+			seen[d.Path] = true
+			prefixes = append(prefixes, d.Path)
+		}
+	}
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+// subsumed reports whether the literal Disallow rule d is redundant because
+// another of the blocked rules is a shorter prefix of it, with no Allow rule
+// of g in between.
+func (g *Group) subsumed(d *Rule, blocked []*Rule) bool {
+	if d.isPattern() {
+		return false
+	}
+	for _, e := range blocked {
+		if e.isPattern() || len(e.Path) >= len(d.Path) || !strings.HasPrefix(d.Path, e.Path) {
+			continue
+		}
+		carved := false
+		for _, a := range g.Rules {
+			if a.Allow && len(a.Path) > len(e.Path) && (a.isPattern() || strings.HasPrefix(d.Path, a.Path)) {
+				carved = true
+				break
+			}
+		}
+		if !carved {
+			return true
+		}
+	}
+	return false
+}
+
+// TestPattern reports whether the URLs described by urlTemplate, a path in
+// which "*" stands for any text, are disallowed for agent. uncertain is
+// true when some of those URLs may be allowed and others disallowed, in
+// which case blocked is the answer for the template's literal prefix.
+func (r *RobotsData) TestPattern(urlTemplate, agent string) (blocked bool, uncertain bool) {
+	if r.AllowAll || r.DisallowAll {
+		return r.DisallowAll, false
+	}
+	g := r.FindGroup(agent)
+	i := strings.IndexByte(urlTemplate, '*')
+	if i < 0 {
+		return !g.Test(strings.TrimSuffix(urlTemplate, "$")), false
+	}
+
+	// Every URL of the template starts with prefix. Rules matching prefix
+	// match all of them (see shadowedBy), the winner of those is the answer
+	// unless a more specific rule with the opposite outcome may match some.
+	prefix := urlTemplate[:i]
+	base := g.findRule(prefix)
+	baseLen := 0
+	if base != nil {
+		if strings.HasSuffix(base.Path, "$") {
+			return !base.Allow, true
+		}
+		baseLen = base.weight()
+	}
+	allow := base == nil || base.Allow
+	for _, rule := range g.Rules {
+		if rule.Allow == allow || rule.specificity(prefix) > 0 {
+			continue
+		}
+		// A rule only matches paths starting with the text before its
+		// first wildcard.
+		partial := strings.HasPrefix(rule.Path, prefix)
+		if rule.isPattern() {
+			literal := strings.TrimSuffix(rule.Path, "$")
+			if i := strings.IndexByte(literal, '*'); i >= 0 {
+				literal = literal[:i]
+			}
+			partial = strings.HasPrefix(prefix, literal) || strings.HasPrefix(literal, prefix)
+		}
+		if partial && rule.weight() >= baseLen {
+			return !allow, true
+		}
+	}
+	return !allow, false
+}
+
+// MaxPathSpecificity returns the specificity, as used to rank matching
+// rules, of the most specific rule applying to agent. It is zero when no
+// rule applies.
+func (r *RobotsData) MaxPathSpecificity(agent string) int {
+	if r.AllowAll || r.DisallowAll {
+		return 0
+	}
+	max := 0
+	for _, rule := range r.FindGroup(agent).Rules {
+		if w := rule.weight(); w > max {
+			max = w
+		}
+	}
+	return max
+}
+
+// RulesByType returns the rules applying to agent split into Allow and
+// Disallow rules, each in source order.
+func (r *RobotsData) RulesByType(agent string) (allows []*Rule, disallows []*Rule) {
+	if r.AllowAll || r.DisallowAll {
+		return nil, nil
+	}
+	for _, rule := range r.FindGroup(agent).Rules {
+		if rule.Allow {
+			allows = append(allows, rule)
+		} else {
+			disallows = append(disallows, rule)
+		}
+	}
+	return
+}
+
+// AllowAllAgents reports whether no path is disallowed for any agent. Unlike
+// the AllowAll field, which is only set when there are no rules at all, it
+// also holds for files whose Disallow rules are all overridden by Allow
+// rules. A Disallow rule with wildcards only counts as overridden by an
+// Allow rule with the same path.
+func (r *RobotsData) AllowAllAgents() bool {
+	if r.AllowAll {
+		return true
+	}
+	if r.DisallowAll {
+		return false
+	}
+	for _, g := range r.Groups {
+		for _, rule := range g.Rules {
+			if rule.Allow {
+				continue
+			}
+			if by := g.shadowedBy(rule); by == nil || !by.Allow {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ConflictsWith returns, in the order given, the samplePaths on which r and
+// other disagree for agent, for instance because two origins of a site
+// serve different robots.txt.
+func (r *RobotsData) ConflictsWith(other *RobotsData, samplePaths []string, agent string) []string {
+	var conflicts []string
+	for _, path := range samplePaths {
+		if r.TestAgent(path, agent) != other.TestAgent(path, agent) {
+			conflicts = append(conflicts, path)
+		}
+	}
+	return conflicts
+}
+
+// AllowedByBoth reports whether path is allowed for agent by both r and
+// other, the policy to follow when a crawler must satisfy two robots.txt at
+// once: a path disallowed by either of them is disallowed.
+func (r *RobotsData) AllowedByBoth(other *RobotsData, path, agent string) bool {
+	return r.TestAgent(path, agent) && other.TestAgent(path, agent)
+}
+
+// Summary returns a one line description of r for logs, such as
+// "3 groups, 12 rules, 2 sitemaps, host=example.com, crawl-delay(*)=5s".
+// Host and crawl delay are left out when not set.
+func (r *RobotsData) Summary() string {
+	switch {
+	case r.AllowAll:
+		return "allow all"
+	case r.DisallowAll:
+		return "disallow all"
+	}
+	// Rules listed for several agents are counted once
+	rules := make(map[*Rule]bool)
+	for _, g := range r.Groups {
+		for _, rule := range g.Rules {
+			rules[rule] = true
+		}
+	}
+	s := fmt.Sprintf("%d groups, %d rules, %d sitemaps", len(r.Groups), len(rules), len(r.Sitemaps))
+	if r.Host != "" {
+		s += ", host=" + r.Host
+	}
+	if g := r.Groups["*"]; g != nil && g.CrawlDelay > 0 {
+		s += ", crawl-delay(*)=" + g.CrawlDelay.String()
+	}
+	return s
+}
+
+// TestAll tests each of paths for every declared agent and for "*", and
+// returns the decisions keyed by agent, then by path.
+func (r *RobotsData) TestAll(paths []string) map[string]map[string]bool {
+	agents := append(r.agentNames(), "*")
+	matrix := make(map[string]map[string]bool, len(agents))
+	for _, a := range agents {
+		if matrix[a] != nil {
+			continue
+		}
+		decisions := make(map[string]bool, len(paths))
+		for _, path := range paths {
+			decisions[path] = r.TestAgent(path, a)
+		}
+		matrix[a] = decisions
+	}
+	return matrix
+}
+
+// PatternRules returns, in source order, the rules applying to agent that
+// use wildcards, "*" or a final "$".
+func (r *RobotsData) PatternRules(agent string) []*Rule {
+	if r.AllowAll || r.DisallowAll {
+		return nil
+	}
+	var rules []*Rule
+	for _, rule := range r.FindGroup(agent).Rules {
+		if rule.isPattern() {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// AmbiguousRules returns, in source order, the wildcard rules applying to
+// agent that match different paths depending on whether they are read
+// anchored at the start of the path, as this package and the major search
+// engines do, or as a substring of it, as some crawlers do. A rule starting
+// with "*" or "/*" matches the same paths either way.
+func (r *RobotsData) AmbiguousRules(agent string) []*Rule {
+	var rules []*Rule
+	for _, rule := range r.PatternRules(agent) {
+		if !strings.Contains(rule.Path, "*") {
+			continue
+		}
+		if strings.HasPrefix(rule.Path, "*") || strings.HasPrefix(rule.Path, "/*") {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// Touches reports whether any rule applying to agent matches path, whether
+// it allows or disallows it. DisallowAll data touches every path, AllowAll
+// data none.
+func (r *RobotsData) Touches(path, agent string) bool {
+	if r.AllowAll || r.DisallowAll {
+		return r.DisallowAll
+	}
+	return r.FindGroup(agent).findRule(path) != nil
+}
+
+// DominantAgent returns the agent whose group has the most rules, often
+// "*", the first in sorted order on a tie. It is empty when there are no
+// groups.
+func (r *RobotsData) DominantAgent() string {
+	dominant, max := "", -1
+	for _, agent := range r.agentNames() {
+		if n := len(r.Groups[agent].Rules); n > max {
+			dominant, max = agent, n
+		}
+	}
+	return dominant
+}
+
+// RuleCounts returns the number of rules of each group, keyed like Groups.
+// A rule listed for several agents counts for each of them.
+func (r *RobotsData) RuleCounts() map[string]int {
+	counts := make(map[string]int, len(r.Groups))
+	for agent, g := range r.Groups {
+		counts[agent] = len(g.Rules)
+	}
+	return counts
+}
+
+// AllowedUnder reports whether prefix is disallowed for agent and, if it
+// is, returns in sorted order the paths and patterns of the Allow rules
+// re-allowing parts of it, the carve-outs. Allow rules always beaten by a
+// Disallow rule are left out.
+func (r *RobotsData) AllowedUnder(prefix, agent string) (blocked bool, carveOuts []string) {
+	if r.TestAgent(prefix, agent) {
+		return false, nil
+	}
+	if r.DisallowAll {
+		return true, nil
+	}
+	g := r.FindGroup(agent)
+	prefix = g.subject(prefix)
+	seen := make(map[string]bool)
+	for _, rule := range g.Rules {
+		if !rule.Allow || seen[rule.Path] || len(rule.Path) <= len(prefix) || !strings.HasPrefix(rule.Path, prefix) {
+			continue
+		}
+		if g.shadowedBy(rule) == nil {
+			seen[rule.Path] = true
+			carveOuts = append(carveOuts, rule.Path)
+		}
+	}
+	sort.Strings(carveOuts)
+	return true, carveOuts
+}
+
+// PathDepthHistogram counts the rules applying to agent by the depth of
+// their path, the number of "/" it holds not counting a trailing one: "/"
+// has depth 0, "/a" and "/a/" depth 1, "/a/*.php" depth 2.
+func (r *RobotsData) PathDepthHistogram(agent string) map[int]int {
+	hist := make(map[int]int)
+	if r.AllowAll || r.DisallowAll {
+		return hist
+	}
+	for _, rule := range r.FindGroup(agent).Rules {
+		path := strings.TrimSuffix(strings.TrimSuffix(rule.Path, "$"), "/")
+		hist[strings.Count(path, "/")]++
+	}
+	return hist
+}
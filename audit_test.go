@@ -0,0 +1,435 @@
+package robotstxt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const robotsCaseAudit = `User-agent: *
+Disallow: /private
+
+User-agent: badbot
+Disallow: /
+
+User-agent: greedybot
+Disallow: /*
+
+User-agent: partialbot
+Disallow: /
+Allow: /public
+
+User-agent: homebot
+Disallow: /$
+`
+
+func TestFullyDisallowedAgents(t *testing.T) {
+	t.Parallel()
+	r, err := FromString(robotsCaseAudit)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"badbot", "greedybot"}, r.FullyDisallowedAgents())
+
+	r, err = FromStatusAndString(500, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"*"}, r.FullyDisallowedAgents())
+
+	r, err = FromString("")
+	require.NoError(t, err)
+	assert.Empty(t, r.FullyDisallowedAgents())
+}
+
+func TestAgentsDisallowed(t *testing.T) {
+	t.Parallel()
+	r, err := FromString(robotsCaseAudit)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"*", "badbot", "greedybot", "partialbot"}, r.AgentsDisallowed("/private"))
+	assert.Equal(t, []string{"badbot", "greedybot"}, r.AgentsDisallowed("/public"))
+	assert.Equal(t, []string{"badbot", "greedybot", "homebot", "partialbot"}, r.AgentsDisallowed("/"))
+
+	r, err = FromString("")
+	require.NoError(t, err)
+	assert.Empty(t, r.AgentsDisallowed("/private"))
+}
+
+func TestPaths(t *testing.T) {
+	t.Parallel()
+	r, err := FromString(robotsCaseAudit)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/", "/$", "/private", "/public"}, r.Paths())
+
+	r, err = FromString("")
+	require.NoError(t, err)
+	assert.Empty(t, r.Paths())
+}
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+	r, err := FromString(robotsCaseAudit)
+	require.NoError(t, err)
+	urls := []string{
+		"https://example.com/",
+		"https://example.com/private/1",
+		"/private?x=1",
+		"https://example.com",
+		"/public",
+		"http://[::1",
+		"%zz",
+	}
+	allowed, disallowed, errored := r.Classify(urls, "bot")
+	assert.Equal(t, []int{3, 2, 2}, []int{allowed, disallowed, errored})
+
+	allowed, disallowed, errored = r.Classify(urls, "badbot")
+	assert.Equal(t, []int{0, 5, 2}, []int{allowed, disallowed, errored})
+}
+
+func TestBlockedPrefixes(t *testing.T) {
+	t.Parallel()
+	const robotsCaseBlocked = `User-agent: nested
+Disallow: /admin/users
+Disallow: /admin
+Disallow: /admin/
+Disallow: /tmp
+Disallow: /*.bak$
+
+User-agent: carve
+Disallow: /app
+Allow: /app/public
+Disallow: /app/public/secret
+Disallow: /app/private
+
+User-agent: undone
+Allow: /x
+Disallow: /x
+Disallow: /y
+`
+	r, err := FromString(robotsCaseBlocked)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/*.bak$", "/admin", "/tmp"}, r.BlockedPrefixes("nested"))
+	assert.Equal(t, []string{"/app", "/app/public/secret"}, r.BlockedPrefixes("carve"))
+	assert.Equal(t, []string{"/y"}, r.BlockedPrefixes("undone"))
+	assert.Empty(t, r.BlockedPrefixes("other"))
+
+	// The Allow rule wins on "/ac" but not on "/abc"
+	r, err = FromString("User-agent: *\nDisallow: /a*c\nAllow: /*ac\n")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/a*c"}, r.BlockedPrefixes("bot"))
+
+	r, err = FromStatusAndString(503, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/"}, r.BlockedPrefixes("bot"))
+}
+
+func TestTestPattern(t *testing.T) {
+	t.Parallel()
+	const robotsCasePattern = `User-agent: *
+Disallow: /products/
+Allow: /products/public/
+Disallow: /search
+Disallow: /*.pdf$
+`
+	r, err := FromString(robotsCasePattern)
+	require.NoError(t, err)
+	cases := []struct {
+		template  string
+		blocked   bool
+		uncertain bool
+	}{
+		{"/search/*", true, false},
+		{"/search*/results", true, false},
+		{"/blog/*/comments", false, true}, // may end in .pdf
+		{"/products/*", true, true},
+		{"/products/public/*", false, false},
+		{"/about", false, false},
+		{"/products/item", true, false},
+	}
+	for _, c := range cases {
+		blocked, uncertain := r.TestPattern(c.template, "bot")
+		assert.Equal(t, c.blocked, blocked, c.template)
+		assert.Equal(t, c.uncertain, uncertain, c.template)
+	}
+
+	// Patterns for other directories do not matter
+	r, err = FromString("User-agent: *\nDisallow: /c/\nAllow: /a/*.pdf\nDisallow: /b/*.pdf\n")
+	require.NoError(t, err)
+	for _, c := range []struct {
+		template  string
+		blocked   bool
+		uncertain bool
+	}{
+		{"/c/*", true, false},
+		{"/a/*", false, false},
+		{"/b/*", false, true},
+		{"/*", false, true},
+	} {
+		blocked, uncertain := r.TestPattern(c.template, "bot")
+		assert.Equal(t, c.blocked, blocked, c.template)
+		assert.Equal(t, c.uncertain, uncertain, c.template)
+	}
+
+	r, err = FromString("User-agent: *\nDisallow: /admin\n")
+	require.NoError(t, err)
+	blocked, uncertain := r.TestPattern("/blog/*", "bot")
+	assert.False(t, blocked)
+	assert.False(t, uncertain)
+}
+
+func TestMaxPathSpecificity(t *testing.T) {
+	t.Parallel()
+	r, err := FromString("User-agent: *\nDisallow: /\nAllow: /docs\nDisallow: /docs/internal/\n\nUser-agent: bot\nDisallow: /a")
+	require.NoError(t, err)
+	assert.Equal(t, len("/docs/internal/"), r.MaxPathSpecificity("other"))
+	assert.Equal(t, 2, r.MaxPathSpecificity("bot"))
+
+	r, err = FromString("")
+	require.NoError(t, err)
+	assert.Equal(t, 0, r.MaxPathSpecificity("bot"))
+}
+
+func TestRulesByType(t *testing.T) {
+	t.Parallel()
+	r, err := FromString("User-agent: bot\nDisallow: /a\nAllow: /a/b\nDisallow: /c\nAllow: /d\n")
+	require.NoError(t, err)
+	allows, disallows := r.RulesByType("bot")
+	require.Len(t, allows, 2)
+	require.Len(t, disallows, 2)
+	assert.Equal(t, "/a/b", allows[0].Path)
+	assert.Equal(t, "/d", allows[1].Path)
+	assert.Equal(t, "/a", disallows[0].Path)
+	assert.Equal(t, "/c", disallows[1].Path)
+
+	allows, disallows = r.RulesByType("other")
+	assert.Empty(t, allows)
+	assert.Empty(t, disallows)
+}
+
+func TestAllowAllAgents(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		input string
+		allow bool
+	}{
+		{"", true},
+		{"User-agent: *\nDisallow:\n", true},
+		{"User-agent: *\nAllow: /\nUser-agent: bot\nCrawl-delay: 5\n", true},
+		{"User-agent: *\nDisallow: /page\nAllow: /*page\n", true},
+		{"User-agent: *\nDisallow: /private\n", false},
+		{"User-agent: *\nAllow: /\nUser-agent: bot\nDisallow: /\n", false},
+		{"User-agent: *\nAllow: /private\nDisallow: /private*.html\n", false},
+		{"User-agent: *\nDisallow: /a*c\nAllow: /*ac\n", false},
+		{robotsCaseAudit, false},
+	}
+	for _, c := range cases {
+		r, err := FromString(c.input)
+		require.NoError(t, err)
+		assert.Equal(t, c.allow, r.AllowAllAgents(), "%q", c.input)
+	}
+	r, err := FromStatusAndString(503, "")
+	require.NoError(t, err)
+	assert.False(t, r.AllowAllAgents())
+}
+
+func TestConflictsWith(t *testing.T) {
+	t.Parallel()
+	a, err := FromString("User-agent: *\nDisallow: /private\nDisallow: /tmp\n")
+	require.NoError(t, err)
+	b, err := FromString("User-agent: *\nDisallow: /private\nAllow: /private/docs\nUser-agent: bot\nDisallow: /\n")
+	require.NoError(t, err)
+	paths := []string{"/", "/private", "/private/docs", "/tmp/a", "/public"}
+	assert.Equal(t, []string{"/private/docs", "/tmp/a"}, a.ConflictsWith(b, paths, "other"))
+	assert.Equal(t, []string{"/", "/public"}, a.ConflictsWith(b, paths, "bot"))
+	assert.Empty(t, a.ConflictsWith(a, paths, "bot"))
+}
+
+func TestSummary(t *testing.T) {
+	t.Parallel()
+	r, err := FromString(`User-agent: a
+User-agent: b
+Disallow: /private
+Allow: /private/public
+
+User-agent: *
+Crawl-delay: 5
+Disallow: /tmp
+
+Host: example.com
+Sitemap: https://example.com/a.xml
+Sitemap: https://example.com/b.xml`)
+	require.NoError(t, err)
+	assert.Equal(t, "3 groups, 3 rules, 2 sitemaps, host=example.com, crawl-delay(*)=5s", r.Summary())
+
+	r, err = FromString(robotsCaseAudit)
+	require.NoError(t, err)
+	assert.Equal(t, "5 groups, 6 rules, 0 sitemaps", r.Summary())
+
+	r, err = FromString("")
+	require.NoError(t, err)
+	assert.Equal(t, "allow all", r.Summary())
+}
+
+func TestTestAll(t *testing.T) {
+	t.Parallel()
+	r, err := FromString("User-agent: Googlebot\nDisallow: /private\n\nUser-agent: badbot\nDisallow: /\n")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]map[string]bool{
+		"googlebot": {"/": true, "/private": false},
+		"badbot":    {"/": false, "/private": false},
+		"*":         {"/": true, "/private": true},
+	}, r.TestAll([]string{"/", "/private"}))
+
+	r, err = FromStatusAndString(503, "")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]map[string]bool{"*": {"/": false}}, r.TestAll([]string{"/"}))
+}
+
+func TestPatternRules(t *testing.T) {
+	t.Parallel()
+	r, err := FromString("User-agent: *\nDisallow: /private\nDisallow: /*.php$\nAllow: /public*\nAllow: /a*b\nDisallow: /end$\n")
+	require.NoError(t, err)
+	var paths []string
+	for _, rule := range r.PatternRules("bot") {
+		paths = append(paths, rule.Path)
+	}
+	// "/public*" is the literal "/public" once the trailing "*" is dropped
+	assert.Equal(t, []string{"/*.php$", "/a*b", "/end$"}, paths)
+
+	r, err = FromString("User-agent: *\nDisallow: /private\n")
+	require.NoError(t, err)
+	assert.Empty(t, r.PatternRules("bot"))
+}
+
+func TestAllowedByBoth(t *testing.T) {
+	t.Parallel()
+	a, err := FromString("User-agent: *\nDisallow: /private\nDisallow: /tmp\n")
+	require.NoError(t, err)
+	b, err := FromString("User-agent: *\nDisallow: /\nAllow: /public\nAllow: /tmp\n")
+	require.NoError(t, err)
+	cases := []struct {
+		path  string
+		allow bool
+	}{
+		{"/public", true},
+		{"/public/private", true},
+		{"/private", false},
+		{"/tmp", false},
+		{"/other", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.allow, a.AllowedByBoth(b, c.path, "bot"), c.path)
+		assert.Equal(t, c.allow, b.AllowedByBoth(a, c.path, "bot"), c.path)
+	}
+}
+
+func TestAmbiguousRules(t *testing.T) {
+	t.Parallel()
+	r, err := FromString("User-agent: *\nDisallow: /private\nDisallow: /*.php$\nDisallow: *.cgi\nAllow: /a*b\nDisallow: /end$\nDisallow: /tmp/*/cache\n")
+	require.NoError(t, err)
+	var paths []string
+	for _, rule := range r.AmbiguousRules("bot") {
+		paths = append(paths, rule.Path)
+	}
+	assert.Equal(t, []string{"/a*b", "/tmp/*/cache"}, paths)
+	// Read as a substring "/a*b" would also match "/x/ab"
+	expectAccess(t, r, true, "/x/ab", "bot")
+
+	r, err = FromString("User-agent: *\nDisallow: /*.php\n")
+	require.NoError(t, err)
+	assert.Empty(t, r.AmbiguousRules("bot"))
+}
+
+func TestTouches(t *testing.T) {
+	t.Parallel()
+	r, err := FromString("User-agent: *\nAllow: /public\nDisallow: /private\nDisallow: /*.php$\n\nUser-agent: a\nAllow: /\n")
+	require.NoError(t, err)
+	cases := []struct {
+		path    string
+		touches bool
+	}{
+		{"/public/page", true},
+		{"/private", true},
+		{"/index.php", true},
+		{"/index.php5", false},
+		{"/other", false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.touches, r.Touches(c.path, "bot"), c.path)
+	}
+	assert.True(t, r.Touches("/other", "a"))
+
+	r, err = FromStatusAndString(404, "")
+	require.NoError(t, err)
+	assert.False(t, r.Touches("/", "bot"))
+	r, err = FromStatusAndString(503, "")
+	require.NoError(t, err)
+	assert.True(t, r.Touches("/", "bot"))
+}
+
+func TestDominantAgent(t *testing.T) {
+	t.Parallel()
+	r, err := FromString("User-agent: b\nDisallow: /b1\nDisallow: /b2\n\nUser-agent: *\nDisallow: /1\nDisallow: /2\nDisallow: /3\n\nUser-agent: a\nDisallow: /a\n")
+	require.NoError(t, err)
+	assert.Equal(t, "*", r.DominantAgent())
+
+	r, err = FromString("User-agent: b\nDisallow: /b1\nDisallow: /b2\n\nUser-agent: a\nDisallow: /a1\nDisallow: /a2\n\nUser-agent: *\nDisallow: /\n")
+	require.NoError(t, err)
+	assert.Equal(t, "a", r.DominantAgent())
+
+	r, err = FromStatusAndString(404, "")
+	require.NoError(t, err)
+	assert.Equal(t, "", r.DominantAgent())
+}
+
+func TestRuleCounts(t *testing.T) {
+	t.Parallel()
+	r, err := FromString("User-agent: a\nUser-agent: b\nDisallow: /ab\n\nUser-agent: *\nDisallow: /1\nAllow: /1/2\n\nUser-agent: B\nDisallow: /b\n\nUser-agent: c\nCrawl-delay: 1\n")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"a": 1, "b": 2, "*": 2, "c": 0}, r.RuleCounts())
+
+	r, err = FromStatusAndString(404, "")
+	require.NoError(t, err)
+	assert.Empty(t, r.RuleCounts())
+}
+
+func TestAllowedUnder(t *testing.T) {
+	t.Parallel()
+	r, err := FromString("User-agent: *\nDisallow: /app\nAllow: /app/public\nAllow: /app/*.css$\nAllow: /app/beta\nDisallow: /app/beta\nAllow: /other\n")
+	require.NoError(t, err)
+
+	blocked, carveOuts := r.AllowedUnder("/app", "bot")
+	assert.True(t, blocked)
+	assert.Equal(t, []string{"/app/*.css$", "/app/beta", "/app/public"}, carveOuts)
+
+	blocked, carveOuts = r.AllowedUnder("/app/private", "bot")
+	assert.True(t, blocked)
+	assert.Empty(t, carveOuts)
+
+	blocked, carveOuts = r.AllowedUnder("/app/public", "bot")
+	assert.False(t, blocked)
+	assert.Empty(t, carveOuts)
+
+	// The Disallow rule wins on "/app/bc" but not on "/app/bxc"
+	r, err = FromString("User-agent: *\nDisallow: /app\nAllow: /app/b*c\nDisallow: /app/**bc\n")
+	require.NoError(t, err)
+	expectAccess(t, r, true, "/app/bxc", "bot")
+	blocked, carveOuts = r.AllowedUnder("/app", "bot")
+	assert.True(t, blocked)
+	assert.Equal(t, []string{"/app/b*c"}, carveOuts)
+
+	r, err = FromStatusAndString(503, "")
+	require.NoError(t, err)
+	blocked, carveOuts = r.AllowedUnder("/app", "bot")
+	assert.True(t, blocked)
+	assert.Empty(t, carveOuts)
+}
+
+func TestPathDepthHistogram(t *testing.T) {
+	t.Parallel()
+	r, err := FromString("User-agent: *\nDisallow: /\nAllow: /a\nDisallow: /b/\nDisallow: /a/b\nAllow: /a/b/c$\nDisallow: /a/*.php\nDisallow: *.cgi\n\nUser-agent: x\nDisallow: /x\n")
+	require.NoError(t, err)
+	assert.Equal(t, map[int]int{0: 2, 1: 2, 2: 2, 3: 1}, r.PathDepthHistogram("bot"))
+	assert.Equal(t, map[int]int{1: 1}, r.PathDepthHistogram("x"))
+
+	r, err = FromStatusAndString(404, "")
+	require.NoError(t, err)
+	assert.Empty(t, r.PathDepthHistogram("bot"))
+}
@@ -0,0 +1,36 @@
+package robotstxt
+
+import "context"
+
+// Decision is the outcome of testing one path with TestBatch.
+type Decision struct {
+	Path    string
+	Allowed bool
+}
+
+// TestBatch tests the paths received from paths for agent, like TestAgent,
+// and sends a Decision for each of them, in order, on the returned channel.
+// The channel is closed once paths is closed or ctx is done, whichever
+// happens first.
+func (r *RobotsData) TestBatch(ctx context.Context, agent string, paths <-chan string) <-chan Decision {
+	out := make(chan Decision)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case path, ok := <-paths:
+				if !ok {
+					return
+				}
+				select {
+				case out <- Decision{Path: path, Allowed: r.TestAgent(path, agent)}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
@@ -0,0 +1,49 @@
+package robotstxt
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTestBatch(t *testing.T) {
+	t.Parallel()
+	r, err := FromString("User-agent: *\nDisallow: /private\n")
+	require.NoError(t, err)
+
+	paths := make(chan string)
+	go func() {
+		defer close(paths)
+		for _, p := range []string{"/", "/private", "/private/a", "/public"} {
+			paths <- p
+		}
+	}()
+	var decisions []Decision
+	for d := range r.TestBatch(context.Background(), "bot", paths) {
+		decisions = append(decisions, d)
+	}
+	assert.Equal(t, []Decision{
+		{"/", true},
+		{"/private", false},
+		{"/private/a", false},
+		{"/public", true},
+	}, decisions)
+}
+
+func TestTestBatchCancel(t *testing.T) {
+	t.Parallel()
+	r, err := FromString("User-agent: *\nDisallow: /private\n")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	paths := make(chan string, 1)
+	paths <- "/private"
+	out := r.TestBatch(ctx, "bot", paths)
+	assert.Equal(t, Decision{"/private", false}, <-out)
+	cancel()
+	// paths is never closed, the channel is closed by the cancellation
+	for range out {
+	}
+}
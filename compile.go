@@ -0,0 +1,114 @@
+package robotstxt
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrCompiled is returned by AddRule on data prepared by Compile.
+var ErrCompiled = errors.New("robotstxt: RobotsData is compiled, it cannot be modified")
+
+// Compile prepares r for heavy concurrent use: it rebuilds the agent index
+// FindGroup uses, in case Groups was modified, and indexes the rules of each
+// group. Rules without wildcards are then found by looking up the prefixes
+// of a path, and rules with wildcards are tried by decreasing specificity
+// only until none can win, instead of trying every rule. Answers are
+// unchanged.
+//
+// r must not be modified afterwards, AddRule fails with ErrCompiled. Like
+// any RobotsData that is no longer modified, compiled data can be queried
+// from many goroutines at once without locking. Compile itself must not be
+// called concurrently with queries.
+func (r *RobotsData) Compile() {
+	r.indexAgents()
+	for _, g := range r.Groups {
+		g.compile()
+	}
+	for _, g := range r.DuplicateGroups {
+		g.compile()
+	}
+	r.compiled = true
+}
+
+// ruleIndex is the lookup structure Compile builds for a group.
+type ruleIndex struct {
+	n        int              // len(Group.Rules) when built
+	literal  map[string][]int // Positions in Rules of the rules of each path without wildcards
+	lengths  []int            // Lengths of the literal paths, longest first
+	patterns []int            // Positions of the rules with wildcards, most specific first
+}
+
+func (g *Group) compile() {
+	ix := &ruleIndex{n: len(g.Rules), literal: make(map[string][]int)}
+	for i, r := range g.Rules {
+		if r.isPattern() {
+			ix.patterns = append(ix.patterns, i)
+			continue
+		}
+		if ix.literal[r.Path] == nil {
+			ix.lengths = append(ix.lengths, len(r.Path))
+		}
+		ix.literal[r.Path] = append(ix.literal[r.Path], i)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(ix.lengths)))
+	ix.lengths = uniqueInts(ix.lengths)
+	sort.SliceStable(ix.patterns, func(i, j int) bool {
+		return g.Rules[ix.patterns[i]].weight() > g.Rules[ix.patterns[j]].weight()
+	})
+	g.index = ix
+}
+
+// uniqueInts removes repeated values of the sorted s.
+func uniqueInts(s []int) []int {
+	out := s[:0]
+	for i, v := range s {
+		if i == 0 || v != s[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// findRuleIndexed is findRuleTie using g.index, path being the subject.
+func (g *Group) findRuleIndexed(path string, tie tieBreak) *Rule {
+	ix := g.index
+	// Positions of the rules matching path that may win
+	var candidates []int
+	best := 0
+	for _, n := range ix.lengths {
+		if n > len(path) {
+			continue
+		}
+		for _, i := range ix.literal[path[:n]] {
+			candidates = append(candidates, i)
+			if w := g.Rules[i].specificity(path); w > best {
+				best = w
+			}
+		}
+	}
+	for _, i := range ix.patterns {
+		r := g.Rules[i]
+		if r.weight() < best {
+			// No rule left can win
+			break
+		}
+		if r.matches(path) {
+			candidates = append(candidates, i)
+			best = r.weight()
+		}
+	}
+	// Break ties in source order, as findRuleTie does
+	sort.Ints(candidates)
+	var (
+		ret       *Rule
+		prefixLen int
+	)
+	for _, i := range candidates {
+		r := g.Rules[i]
+		if l := r.specificity(path); tie.wins(r, l, ret, prefixLen) {
+			prefixLen = l
+			ret = r
+		}
+	}
+	return ret
+}
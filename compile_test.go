@@ -0,0 +1,92 @@
+package robotstxt
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// robotsManyRules returns a robots.txt with n rules for "*" and for
+// "bot", mixing prefixes, wildcards and Allow exceptions.
+func robotsManyRules(n int) string {
+	var b strings.Builder
+	for _, agent := range []string{"*", "bot"} {
+		b.WriteString("User-agent: " + agent + "\n")
+		for i := 0; i < n; i++ {
+			switch i % 4 {
+			case 0:
+				fmt.Fprintf(&b, "Disallow: /section%d/\n", i)
+			case 1:
+				fmt.Fprintf(&b, "Allow: /section%d/public\n", i-1)
+			case 2:
+				fmt.Fprintf(&b, "Disallow: /*/tmp%d$\n", i)
+			default:
+				fmt.Fprintf(&b, "Disallow: /s%d\n", i)
+			}
+		}
+		b.WriteString("Allow: /section0/\nDisallow: /\n\n")
+	}
+	return b.String()
+}
+
+var compilePaths = []string{
+	"/", "/section0/", "/section0/x", "/section4/public/a", "/section4/private",
+	"/a/tmp2", "/a/tmp2/b", "/s3", "/s30", "/section96/", "/other",
+}
+
+func TestCompile(t *testing.T) {
+	t.Parallel()
+	input := robotsManyRules(100) + "User-agent: tie\nAllow: /page\nDisallow: /page\n"
+	for _, opts := range []ParseOptions{{}, {MatchStrategy: MatchLegacy}} {
+		r, err := FromBytesWithOptions([]byte(input), opts)
+		require.NoError(t, err)
+		c, err := FromBytesWithOptions([]byte(input), opts)
+		require.NoError(t, err)
+		c.Compile()
+		for _, agent := range []string{"bot", "other", "tie"} {
+			for _, path := range append(compilePaths, "/page") {
+				want, got := r.FindGroup(agent).FindRule(path), c.FindGroup(agent).FindRule(path)
+				if want == nil {
+					assert.Nil(t, got, "%s %s %v", agent, path, opts.MatchStrategy)
+					continue
+				}
+				require.NotNil(t, got, "%s %s %v", agent, path, opts.MatchStrategy)
+				assert.Equal(t, want.Line, got.Line, "%s %s %v", agent, path, opts.MatchStrategy)
+			}
+		}
+		assert.Equal(t, ErrCompiled, c.AddRule("bot", "/x", true))
+	}
+
+	// A group modified anyway is still matched correctly
+	r, err := FromString("User-agent: *\nDisallow: /a\n")
+	require.NoError(t, err)
+	r.Compile()
+	g := r.FindGroup("bot")
+	g.Rules = append(g.Rules, &Rule{Path: "/a/b", Allow: true})
+	assert.True(t, g.Test("/a/b"))
+}
+
+func BenchmarkCompile(b *testing.B) {
+	input := robotsManyRules(400)
+	for _, compile := range []bool{false, true} {
+		r, err := FromString(input)
+		if err != nil {
+			b.Fatal(err)
+		}
+		name := "parsed"
+		if compile {
+			r.Compile()
+			name = "compiled"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					r.TestAgent(compilePaths[i%len(compilePaths)], "Bot/1.0")
+				}
+			})
+		})
+	}
+}
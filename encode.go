@@ -0,0 +1,333 @@
+package robotstxt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+)
+
+type jsonRobots struct {
+	AllowAll    bool        `json:"allow_all,omitempty"`
+	DisallowAll bool        `json:"disallow_all,omitempty"`
+	Groups      []jsonGroup `json:"groups,omitempty"`
+	Host        string      `json:"host,omitempty"`
+	Sitemaps    []string    `json:"sitemaps,omitempty"`
+}
+
+type jsonGroup struct {
+	Agent      string     `json:"agent"`
+	CrawlDelay float64    `json:"crawl_delay,omitempty"` // Seconds
+	Rules      []jsonRule `json:"rules"`
+}
+
+type jsonRule struct {
+	Path  string `json:"path"`
+	Allow bool   `json:"allow"`
+	Line  int    `json:"line,omitempty"`
+}
+
+// MarshalJSON encodes r as an object with groups sorted by agent, crawl
+// delays in seconds and rule paths as written in robots.txt.
+func (r *RobotsData) MarshalJSON() ([]byte, error) {
+	v := jsonRobots{
+		AllowAll:    r.AllowAll,
+		DisallowAll: r.DisallowAll,
+		Host:        r.Host,
+		Sitemaps:    r.Sitemaps,
+	}
+	for _, a := range r.agentNames() {
+		g := r.Groups[a]
+		jg := jsonGroup{Agent: g.Agent, CrawlDelay: g.CrawlDelay.Seconds(), Rules: make([]jsonRule, len(g.Rules))}
+		for i, rule := range g.Rules {
+			jg.Rules[i] = jsonRule{Path: rule.Path, Allow: rule.Allow, Line: rule.Line}
+		}
+		v.Groups = append(v.Groups, jg)
+	}
+	return json.Marshal(v)
+}
+
+// EncodeJSON writes the JSON encoding of r followed by a newline, so that
+// successive calls on the same writer produce newline delimited JSON.
+func (r *RobotsData) EncodeJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(r)
+}
+
+// Fingerprint returns a hex encoded SHA-256 hash of the parsed policy.
+// Files that differ only in formatting, comments, keyword case, the order of
+// groups or, but with MatchLegacy, the order of rules have the same
+// fingerprint.
+func (r *RobotsData) Fingerprint() string {
+	sum := sha256.Sum256(r.canonical())
+	return hex.EncodeToString(sum[:])
+}
+
+// GroupFingerprints returns a fingerprint, like Fingerprint, of each group
+// keyed by agent, to tell which groups changed between two versions of a
+// file. AllowAll and DisallowAll data have no groups.
+func (r *RobotsData) GroupFingerprints() map[string]string {
+	fps := make(map[string]string, len(r.Groups))
+	for a, g := range r.Groups {
+		var b bytes.Buffer
+		g.writeMembers(&b)
+		sum := sha256.Sum256(b.Bytes())
+		fps[a] = hex.EncodeToString(sum[:])
+	}
+	return fps
+}
+
+// Equal reports whether r and other give the same answers: same groups with
+// the same rules and crawl delays, Host and Sitemaps. Formatting, comments,
+// source lines and duplicated rules are ignored.
+func (r *RobotsData) Equal(other *RobotsData) bool {
+	return bytes.Equal(r.canonical(), other.canonical())
+}
+
+// Minify returns the shortest robots.txt equivalent to r: no comments or
+// blank lines, duplicate rules dropped and agents with identical groups
+// sharing one block.
+func (r *RobotsData) Minify() []byte {
+	var b bytes.Buffer
+	switch {
+	case r.DisallowAll:
+		b.WriteString("user-agent:*\ndisallow:/\n")
+	case !r.AllowAll:
+		var order []string
+		blocks := make(map[string][]string)
+		for _, a := range r.agentNames() {
+			var members bytes.Buffer
+			r.Groups[a].writeMembers(&members)
+			key := members.String()
+			if blocks[key] == nil {
+				order = append(order, key)
+			}
+			blocks[key] = append(blocks[key], a)
+		}
+		for _, key := range order {
+			for _, a := range blocks[key] {
+				b.WriteString("user-agent:" + a + "\n")
+			}
+			b.WriteString(key)
+		}
+	}
+	r.writeNonGroup(&b)
+	return b.Bytes()
+}
+
+// String returns r as robots.txt text, see WriteTo.
+func (r *RobotsData) String() string {
+	var b bytes.Buffer
+	r.writeText(&b, r.agentBlocks())
+	return b.String()
+}
+
+// WriteTo writes r as robots.txt text: a block per group, in agent order,
+// with its Crawl-delay and its rules in stored order, then Host and
+// Sitemaps. Parsing the output gives back the same groups. Comments, source
+// lines and the grouping of agents in the original file are not kept.
+func (r *RobotsData) WriteTo(w io.Writer) (int64, error) {
+	var b bytes.Buffer
+	r.writeText(&b, r.agentBlocks())
+	return b.WriteTo(w)
+}
+
+// Encode writes r as robots.txt text like WriteTo, but keeps the order of
+// the groups in the source and, when they still have the same members, the
+// agents listed together in one group. Groups added by AddRule come last,
+// in agent order.
+func (r *RobotsData) Encode(w io.Writer) error {
+	var b bytes.Buffer
+	r.writeText(&b, r.sourceBlocks())
+	_, err := b.WriteTo(w)
+	return err
+}
+
+// sourceBlocks returns the keys of Groups in source order, those of a
+// group listing several agents together.
+func (r *RobotsData) sourceBlocks() [][]string {
+	agents := r.agentNames()
+	sort.SliceStable(agents, func(i, j int) bool {
+		si, sj := r.Groups[agents[i]].seq, r.Groups[agents[j]].seq
+		return si != 0 && (sj == 0 || si < sj)
+	})
+	var blocks [][]string
+	var last string
+	for _, a := range agents {
+		g := r.Groups[a]
+		var members bytes.Buffer
+		g.writeMembers(&members)
+		if n := len(blocks); n > 0 && g.line != 0 && g.line == r.Groups[blocks[n-1][0]].line && members.String() == last {
+			blocks[n-1] = append(blocks[n-1], a)
+			continue
+		}
+		blocks = append(blocks, []string{a})
+		last = members.String()
+	}
+	return blocks
+}
+
+// agentBlocks returns the keys of Groups in sorted order, one per block.
+func (r *RobotsData) agentBlocks() [][]string {
+	var blocks [][]string
+	for _, a := range r.agentNames() {
+		blocks = append(blocks, []string{a})
+	}
+	return blocks
+}
+
+// writeText writes r with one group for each of blocks, the agents of a
+// block sharing the members of the first one.
+func (r *RobotsData) writeText(b *bytes.Buffer, blocks [][]string) {
+	switch {
+	case r.AllowAll:
+		b.WriteString("User-agent: *\nDisallow:\n")
+	case r.DisallowAll:
+		b.WriteString("User-agent: *\nDisallow: /\n")
+	default:
+		for i, block := range blocks {
+			g := r.Groups[block[0]]
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			for _, a := range block {
+				b.WriteString("User-agent: " + r.Groups[a].Agent + "\n")
+			}
+			if g.CrawlDelay > 0 {
+				b.WriteString("Crawl-delay: " + strconv.FormatFloat(g.CrawlDelay.Seconds(), 'f', -1, 64) + "\n")
+			}
+			if g.RequestRate != nil {
+				b.WriteString("Request-rate: " + g.RequestRate.String() + "\n")
+			}
+			if g.VisitTime != nil {
+				b.WriteString("Visit-time: " + g.VisitTime.String() + "\n")
+			}
+			for _, rule := range g.Rules {
+				b.WriteString(rule.String() + "\n")
+			}
+			for _, rule := range g.Noindex {
+				b.WriteString("Noindex: " + rule.Path + "\n")
+			}
+			if g.CrawlDelay <= 0 && len(g.Rules) == 0 {
+				// A group without members would merge with the next one
+				b.WriteString("Disallow:\n")
+			}
+		}
+	}
+	if r.Host != "" || len(r.Sitemaps) > 0 || len(r.CleanParams) > 0 {
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		if r.Host != "" {
+			b.WriteString("Host: " + r.Host + "\n")
+		}
+		for _, s := range r.Sitemaps {
+			b.WriteString("Sitemap: " + s + "\n")
+		}
+		for _, cp := range r.CleanParams {
+			b.WriteString("Clean-param: " + cp.String() + "\n")
+		}
+	}
+}
+
+// WriteDirectives writes r.Directives, one per line. For data parsed with
+// ParseOptions.PreserveOrder from a well formed file, that is one using
+// "Key: value", or "Key:" for an empty value, and "\n" line endings, the
+// output equals the input.
+func (r *RobotsData) WriteDirectives(w io.Writer) error {
+	for i, d := range r.Directives {
+		line := d.String()
+		if i < len(r.Directives)-1 {
+			line += "\n"
+		}
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// canonical returns a serialization of r that only depends on its meaning:
+// groups sorted by agent, each with its crawl delay and rules (whose order
+// decides ties), then host and sitemaps.
+func (r *RobotsData) canonical() []byte {
+	var b bytes.Buffer
+	switch {
+	case r.DisallowAll:
+		b.WriteString("user-agent:*\ndisallow:/\n")
+	case !r.AllowAll:
+		for _, a := range r.agentNames() {
+			b.WriteString("user-agent:" + a + "\n")
+			r.Groups[a].writeMembers(&b)
+		}
+	}
+	r.writeNonGroup(&b)
+	return b.Bytes()
+}
+
+func (r *RobotsData) writeNonGroup(b *bytes.Buffer) {
+	if r.Host != "" {
+		b.WriteString("host:" + r.Host + "\n")
+	}
+	for _, s := range r.Sitemaps {
+		b.WriteString("sitemap:" + s + "\n")
+	}
+	for _, cp := range r.CleanParams {
+		b.WriteString("clean-param:" + cp.String() + "\n")
+	}
+}
+
+// writeMembers writes the crawl delay and rules of g. Rules repeating an
+// earlier rule are left out, they can never take precedence over it. Rules
+// are sorted by path, then Disallow before Allow, unless g is matched with
+// MatchLegacy, whose ties are won by the rule listed first.
+func (g *Group) writeMembers(b *bytes.Buffer) {
+	if g.CrawlDelay > 0 {
+		b.WriteString("crawl-delay:" + strconv.FormatFloat(g.CrawlDelay.Seconds(), 'g', -1, 64) + "\n")
+	}
+	if g.RequestRate != nil {
+		b.WriteString("request-rate:" + g.RequestRate.String() + "\n")
+	}
+	if g.VisitTime != nil {
+		b.WriteString("visit-time:" + g.VisitTime.String() + "\n")
+	}
+	rules, noindex := g.Rules, g.Noindex
+	if g.tie() != tieFirst {
+		rules, noindex = sortedRules(rules), sortedRules(noindex)
+	}
+	seen := make(map[Rule]bool, len(rules))
+	for _, r := range rules {
+		key := Rule{Path: r.Path, Allow: r.Allow}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if r.Allow {
+			b.WriteString("allow:" + r.Path + "\n")
+		} else {
+			b.WriteString("disallow:" + r.Path + "\n")
+		}
+	}
+	for _, r := range noindex {
+		b.WriteString("noindex:" + r.Path + "\n")
+	}
+	if g.CrawlDelay <= 0 && len(g.Rules) == 0 {
+		// Keep the group from merging with the next one
+		b.WriteString("disallow:\n")
+	}
+}
+
+// sortedRules returns a copy of rules sorted by path, then Disallow before
+// Allow.
+func sortedRules(rules []*Rule) []*Rule {
+	sorted := append([]*Rule(nil), rules...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Path != sorted[j].Path {
+			return sorted[i].Path < sorted[j].Path
+		}
+		return !sorted[i].Allow && sorted[j].Allow
+	})
+	return sorted
+}
@@ -0,0 +1,317 @@
+package robotstxt
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprint(t *testing.T) {
+	t.Parallel()
+	const a = `User-agent: a
+User-agent: b
+Disallow: /private
+Allow: /private/ok
+Crawl-delay: 2
+
+User-agent: *
+Disallow: /tmp
+Sitemap: https://example.com/sitemap.xml`
+	const b = `# same policy, different layout
+SITEMAP:https://example.com/sitemap.xml
+user-agent: *
+disallow:   /tmp
+
+user-agent: b
+crawl-delay: 2.0
+disallow: /private
+allow: /private/ok
+user-agent: a
+crawl-delay: 2
+disallow: /private
+allow: /private/ok
+`
+	ra, err := FromString(a)
+	require.NoError(t, err)
+	rb, err := FromString(b)
+	require.NoError(t, err)
+	assert.Len(t, ra.Fingerprint(), 64)
+	assert.Equal(t, ra.Fingerprint(), rb.Fingerprint())
+
+	rc, err := FromString(a + "\nDisallow: /more")
+	require.NoError(t, err)
+	assert.NotEqual(t, ra.Fingerprint(), rc.Fingerprint())
+
+	// The order of rules does not matter, but with MatchLegacy
+	const reordered = "User-agent: *\nAllow: /private/ok\nDisallow: /private\nDisallow: /tmp\n"
+	rd, err := FromString(reordered)
+	require.NoError(t, err)
+	re, err := FromString("User-agent: *\nDisallow: /tmp\nDisallow: /private\nAllow: /private/ok\n")
+	require.NoError(t, err)
+	assert.Equal(t, rd.Fingerprint(), re.Fingerprint())
+	rd, err = FromBytesWithOptions([]byte(reordered), ParseOptions{MatchStrategy: MatchLegacy})
+	require.NoError(t, err)
+	re, err = FromBytesWithOptions([]byte("User-agent: *\nDisallow: /private\nAllow: /private/ok\nDisallow: /tmp\n"), ParseOptions{MatchStrategy: MatchLegacy})
+	require.NoError(t, err)
+	assert.NotEqual(t, rd.Fingerprint(), re.Fingerprint())
+
+	empty, err := FromString("")
+	require.NoError(t, err)
+	none, err := FromStatusAndString(503, "")
+	require.NoError(t, err)
+	assert.NotEqual(t, empty.Fingerprint(), none.Fingerprint())
+}
+
+func TestGroupFingerprints(t *testing.T) {
+	t.Parallel()
+	v1, err := FromString("User-agent: a\nDisallow: /a\n\nUser-agent: b\nDisallow: /b\n")
+	require.NoError(t, err)
+	v2, err := FromString("# reordered\nUser-agent: B\ndisallow: /b\nAllow: /b/public\n\nUser-agent: a\nDisallow: /a\n")
+	require.NoError(t, err)
+	f1, f2 := v1.GroupFingerprints(), v2.GroupFingerprints()
+	require.Len(t, f1, 2)
+	require.Len(t, f2, 2)
+	assert.Equal(t, f1["a"], f2["a"])
+	assert.NotEqual(t, f1["b"], f2["b"])
+	assert.Len(t, f1["a"], 64)
+}
+
+func TestEncodeJSON(t *testing.T) {
+	t.Parallel()
+	inputs := []string{
+		"User-agent: b\nDisallow: /b\nUser-agent: a\nCrawl-delay: 1.5\nAllow: /a$\nHost: example.com\nSitemap: https://example.com/s.xml",
+		"",
+		"User-agent: *\nDisallow: /",
+	}
+	var buf bytes.Buffer
+	for _, input := range inputs {
+		r, err := FromString(input)
+		require.NoError(t, err)
+		require.NoError(t, r.EncodeJSON(&buf))
+	}
+
+	var lines []string
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+		assert.True(t, json.Valid(sc.Bytes()), sc.Text())
+	}
+	assert.Equal(t, []string{
+		`{"groups":[{"agent":"a","crawl_delay":1.5,"rules":[{"path":"/a$","allow":true,"line":5}]},` +
+			`{"agent":"b","rules":[{"path":"/b","allow":false,"line":2}]}],` +
+			`"host":"example.com","sitemaps":["https://example.com/s.xml"]}`,
+		`{"allow_all":true}`,
+		`{"groups":[{"agent":"*","rules":[{"path":"/","allow":false,"line":2}]}]}`,
+	}, lines)
+}
+
+const robotsCaseEmptyGroup = `User-agent: a
+Disallow:
+
+User-agent: b
+Disallow: /x
+`
+
+// groupContents returns the agents, crawl delays and rules of r without
+// source lines.
+func groupContents(r *RobotsData) map[string]string {
+	groups := make(map[string]string, len(r.Groups))
+	for a, g := range r.Groups {
+		s := g.Agent + " " + g.CrawlDelay.String()
+		for _, rule := range g.Rules {
+			s += "\n" + rule.String()
+		}
+		groups[a] = s
+	}
+	return groups
+}
+
+func TestString(t *testing.T) {
+	t.Parallel()
+	for _, input := range []string{robotsText001, robotsGoogle, robotsCaseEmptyGroup, robotsCaseExplain,
+		"User-agent: A\nCrawl-delay: 0.5\nDisallow: /*.php$\nAllow: /x\nHost: example.com\nSitemap: /s.xml"} {
+		r, err := FromString(input)
+		require.NoError(t, err)
+		text := r.String()
+		var b bytes.Buffer
+		n, err := r.WriteTo(&b)
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(text)), n)
+		assert.Equal(t, text, b.String())
+
+		p, err := FromString(text)
+		require.NoError(t, err, text)
+		assert.Equal(t, groupContents(r), groupContents(p), text)
+		assert.Equal(t, r.Host, p.Host)
+		assert.Equal(t, r.Sitemaps, p.Sitemaps)
+	}
+
+	r, err := FromString("User-agent: A\nCrawl-delay: 0.5\nDisallow: /*.php$\nAllow: /x\nHost: example.com\nSitemap: /s.xml")
+	require.NoError(t, err)
+	assert.Equal(t, "User-agent: A\nCrawl-delay: 0.5\nDisallow: /*.php$\nAllow: /x\n\nHost: example.com\nSitemap: /s.xml\n", r.String())
+
+	r, err = FromString("")
+	require.NoError(t, err)
+	assert.Equal(t, "User-agent: *\nDisallow:\n", r.String())
+	r, err = FromStatusAndString(503, "")
+	require.NoError(t, err)
+	assert.Equal(t, "User-agent: *\nDisallow: /\n", r.String())
+	p, err := FromString(r.String())
+	require.NoError(t, err)
+	expectAll(t, p, false)
+}
+
+func TestMinify(t *testing.T) {
+	t.Parallel()
+	const robotsCaseVerbose = `# Verbose robots.txt
+User-agent: a
+Disallow: /private
+Disallow: /private
+Allow: /private/ok
+
+
+User-agent: b
+Disallow: /private
+Allow: /private/ok
+
+User-agent: *
+Crawl-delay: 2
+Disallow: /*.bak$
+
+Sitemap: https://example.com/sitemap.xml
+`
+	for _, input := range []string{robotsCaseVerbose, robotsText001, robotsGoogle, "", "Sitemap: /s.xml", robotsCaseEmptyGroup} {
+		r, err := FromString(input)
+		require.NoError(t, err)
+		min := r.Minify()
+		assert.True(t, len(min) <= len(input), "%q", min)
+		m, err := FromBytes(min)
+		require.NoError(t, err)
+		assert.True(t, r.Equal(m), "%q", min)
+		for _, agent := range []string{"a", "b", "c", "Yandex"} {
+			for _, path := range []string{"/", "/private", "/private/ok", "/x.bak", "/search", "/administrator/"} {
+				assert.Equal(t, r.TestAgent(path, agent), m.TestAgent(path, agent))
+			}
+		}
+	}
+
+	r, err := FromString(robotsCaseVerbose)
+	require.NoError(t, err)
+	assert.Equal(t, "user-agent:*\ncrawl-delay:2\ndisallow:/*.bak$\n"+
+		"user-agent:a\nuser-agent:b\ndisallow:/private\nallow:/private/ok\n"+
+		"sitemap:https://example.com/sitemap.xml\n", string(r.Minify()))
+
+	r, err = FromStatusAndString(503, "")
+	require.NoError(t, err)
+	m, err := FromBytes(r.Minify())
+	require.NoError(t, err)
+	assert.True(t, r.Equal(m))
+	expectAll(t, m, false)
+}
+
+func TestPreserveOrder(t *testing.T) {
+	t.Parallel()
+	const robotsCaseOrdered = `# Robots for example.com
+Sitemap: https://example.com/a.xml
+
+User-agent: a # first
+Disallow: /private
+Sitemap: https://example.com/b.xml
+Allow: /private/ok
+
+#
+User-agent: *
+Crawl-delay: 1
+not a directive
+Disallow: /*.bak$
+
+User-agent: b
+Disallow:
+Allow: # nothing
+`
+	r, err := FromBytesWithOptions([]byte(robotsCaseOrdered), ParseOptions{PreserveOrder: true})
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, r.WriteDirectives(&buf))
+	assert.Equal(t, robotsCaseOrdered, buf.String())
+	assert.Equal(t, Directive{Line: 4, Key: "User-agent", Value: "a", Comment: "# first"}, r.Directives[3])
+	assert.Equal(t, []string{"https://example.com/a.xml", "https://example.com/b.xml"}, r.Sitemaps)
+
+	r, err = FromString(robotsCaseOrdered)
+	require.NoError(t, err)
+	assert.Empty(t, r.Directives)
+}
+
+func TestEncode(t *testing.T) {
+	t.Parallel()
+	const robotsCaseEncode = `# Rules for search engines
+User-agent: Googlebot
+User-agent: bingbot
+Disallow: /search
+Allow: /search/about
+
+User-agent: *
+Crawl-delay: 2
+Disallow: /private
+
+Sitemap: https://example.com/sitemap.xml
+User-agent: Archiver
+Disallow: /
+`
+	r, err := FromString(robotsCaseEncode)
+	require.NoError(t, err)
+	var b bytes.Buffer
+	require.NoError(t, r.Encode(&b))
+	assert.Equal(t, `User-agent: Googlebot
+User-agent: bingbot
+Disallow: /search
+Allow: /search/about
+
+User-agent: *
+Crawl-delay: 2
+Disallow: /private
+
+User-agent: Archiver
+Disallow: /
+
+Sitemap: https://example.com/sitemap.xml
+`, b.String())
+
+	p, err := FromBytes(b.Bytes())
+	require.NoError(t, err)
+	assert.True(t, r.Equal(p))
+
+	// Mutated groups leave their block, added ones come last
+	require.NoError(t, r.AddRule("bingbot", "/tmp", false))
+	require.NoError(t, r.AddRule("Newbot", "/new", false))
+	b.Reset()
+	require.NoError(t, r.Encode(&b))
+	assert.Equal(t, `User-agent: Googlebot
+Disallow: /search
+Allow: /search/about
+
+User-agent: bingbot
+Disallow: /search
+Allow: /search/about
+Disallow: /tmp
+
+User-agent: *
+Crawl-delay: 2
+Disallow: /private
+
+User-agent: Archiver
+Disallow: /
+
+User-agent: Newbot
+Disallow: /new
+
+Sitemap: https://example.com/sitemap.xml
+`, b.String())
+	p, err = FromBytes(b.Bytes())
+	require.NoError(t, err)
+	assert.True(t, r.Equal(p))
+}
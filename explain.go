@@ -0,0 +1,205 @@
+package robotstxt
+
+import "net/url"
+
+// TraceStep records the evaluation of one rule by MatchTrace.
+type TraceStep struct {
+	Rule        *Rule
+	Matched     bool
+	Specificity int  // Zero when the rule does not match
+	Winner      bool // The rule became the current winner
+}
+
+// ReasonCode tells what decided a path, see TestReasonCode. The values are
+// stable, new codes are only ever added at the end.
+type ReasonCode int
+
+const (
+	AllowAll        ReasonCode = iota // The data allows everything
+	DisallowAll                       // The data disallows everything
+	MatchedAllow                      // An Allow rule matches the path
+	MatchedDisallow                   // A Disallow rule matches the path
+	DefaultAllow                      // No rule matches the path
+)
+
+var reasonNames = [...]string{"allow-all", "disallow-all", "matched-allow", "matched-disallow", "default-allow"}
+
+// String returns the code as a metric label, such as "matched-allow".
+func (c ReasonCode) String() string {
+	if c < 0 || int(c) >= len(reasonNames) {
+		return "unknown"
+	}
+	return reasonNames[c]
+}
+
+// TestReasonCode evaluates path for agent like TestAgent and returns what
+// decided it. The path is allowed unless the code is DisallowAll or
+// MatchedDisallow.
+func (r *RobotsData) TestReasonCode(path, agent string) ReasonCode {
+	return r.Explain(path, agent).Reason
+}
+
+// MatchKind tells how the rule deciding a path matched it.
+type MatchKind int
+
+const (
+	MatchNone     MatchKind = iota // No rule decided the path
+	MatchPrefix                    // A rule without wildcards is a prefix of the path
+	MatchWildcard                  // A rule with wildcards matches the path
+)
+
+var matchKindNames = [...]string{"none", "prefix", "wildcard"}
+
+func (k MatchKind) String() string {
+	if k < 0 || int(k) >= len(matchKindNames) {
+		return "unknown"
+	}
+	return matchKindNames[k]
+}
+
+// MatchResult is the outcome of Explain.
+type MatchResult struct {
+	Allowed bool
+	Reason  ReasonCode
+
+	// Group is the group applying to the agent, nil for AllowAll and
+	// DisallowAll data and when no group applies.
+	Group *Group
+
+	// Rule is the rule of Group deciding the path, nil when no rule
+	// matches and the path is allowed by default. Line is its source line,
+	// zero without rule or for rules added with AddRule.
+	Rule *Rule
+	Line int
+	Kind MatchKind
+}
+
+// Explain evaluates path for agent like TestAgent and returns what decided
+// it: the group and rule used, and how the rule matched.
+func (r *RobotsData) Explain(path, agent string) MatchResult {
+	var m MatchResult
+	m.Allowed, m.Group, m.Rule = r.TestAgentExplain(path, agent)
+	switch {
+	case r.AllowAll:
+		m.Reason = AllowAll
+	case r.DisallowAll:
+		m.Reason = DisallowAll
+	case m.Rule == nil:
+		m.Reason = DefaultAllow
+	case m.Rule.Allow:
+		m.Reason = MatchedAllow
+	default:
+		m.Reason = MatchedDisallow
+	}
+	if m.Rule != nil {
+		m.Line = m.Rule.Line
+		m.Kind = MatchPrefix
+		if m.Rule.isPattern() {
+			m.Kind = MatchWildcard
+		}
+	}
+	return m
+}
+
+// MatchedRule returns the rule of g deciding path, nil if no rule matches,
+// and whether path is allowed.
+func (g *Group) MatchedRule(path string) (*Rule, bool) {
+	if rule := g.findRule(path); rule != nil {
+		return rule, rule.Allow
+	}
+	return nil, true
+}
+
+// TestAgentExplain is TestAgent also returning the group applying to agent
+// and the rule of that group deciding path, as stored in the group. rule is
+// nil when no rule matches and path is allowed by default, group is nil for
+// AllowAll and DisallowAll data and when no group applies to agent.
+func (r *RobotsData) TestAgentExplain(path, agent string) (allowed bool, group *Group, rule *Rule) {
+	if r.AllowAll {
+		return true, nil, nil
+	}
+	if r.DisallowAll {
+		return false, nil, nil
+	}
+
+	// Find a group of Rules that applies to this agent
+	// From Google's spec:
+	// The user-agent is non-case-sensitive.
+	if group = r.FindGroup(agent); group == emptyGroup {
+		return true, nil, nil
+	}
+	if rule = group.findRule(path); rule != nil {
+		return rule.Allow, group, rule
+	}
+	// From Google's spec:
+	// By default, there are no restrictions for crawling for the designated crawlers.
+	return true, group, nil
+}
+
+// MatchTrace evaluates path for agent like TestAgent and returns one step
+// per rule of the applicable group, in the order they were considered.
+// The last step with Winner set holds the deciding rule. The trace is empty
+// for AllowAll and DisallowAll data and for agents without a group.
+func (r *RobotsData) MatchTrace(path, agent string) []TraceStep {
+	if r.AllowAll || r.DisallowAll {
+		return nil
+	}
+	g := r.FindGroup(agent)
+	return g.trace(path, g.tie())
+}
+
+// trace mirrors findRuleTie, recording each step.
+func (g *Group) trace(path string, tie tieBreak) []TraceStep {
+	var (
+		steps     = make([]TraceStep, 0, len(g.Rules))
+		ret       *Rule
+		prefixLen int
+	)
+	path = g.subject(path)
+	for _, r := range g.Rules {
+		l := r.specificity(path)
+		step := TraceStep{Rule: r, Matched: l > 0, Specificity: l}
+		if tie.wins(r, l, ret, prefixLen) {
+			prefixLen = l
+			ret = r
+			step.Winner = true
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+// CoverageReport maps each of urls, absolute URLs or paths, to the rule
+// deciding it for agent: the winner of its MatchTrace. The rule is nil when
+// no rule matches and the URL is allowed by default, for AllowAll and
+// DisallowAll data, and for URLs that fail to parse.
+func (r *RobotsData) CoverageReport(urls []string, agent string) map[string]*Rule {
+	report := make(map[string]*Rule, len(urls))
+	g := r.FindGroup(agent)
+	for _, raw := range urls {
+		report[raw] = nil
+		if r.AllowAll || r.DisallowAll {
+			continue
+		}
+		if u, err := url.Parse(raw); err == nil {
+			report[raw] = g.findRule(requestPath(u))
+		}
+	}
+	return report
+}
+
+// RuleAtLine returns the rule parsed from the given source line, nil if the
+// line holds no rule. Rules added with AddRule have no source line.
+func (r *RobotsData) RuleAtLine(line int) *Rule {
+	if line <= 0 {
+		return nil
+	}
+	for _, g := range r.Groups {
+		for _, rule := range g.Rules {
+			if rule.Line == line {
+				return rule
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package robotstxt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const robotsCaseExplain = `User-agent: *
+Disallow: /
+Allow: /shop
+Disallow: /shop/cart
+Disallow: /blog
+Allow: /shop/cart/help
+`
+
+func TestMatchTrace(t *testing.T) {
+	t.Parallel()
+	r, err := FromString(robotsCaseExplain)
+	require.NoError(t, err)
+	steps := r.MatchTrace("/shop/cart/1", "bot")
+	require.Len(t, steps, 5)
+
+	type step struct {
+		path        string
+		matched     bool
+		specificity int
+		winner      bool
+	}
+	expect := []step{
+		{"/", true, 1, true},
+		{"/shop", true, 5, true},
+		{"/shop/cart", true, 10, true},
+		{"/blog", false, 0, false},
+		{"/shop/cart/help", false, 0, false},
+	}
+	for i, s := range steps {
+		assert.Equal(t, expect[i], step{s.Rule.Path, s.Matched, s.Specificity, s.Winner}, "step %d", i)
+	}
+	assert.Equal(t, r.TestAgent("/shop/cart/1", "bot"), steps[2].Rule.Allow)
+
+	r, err = FromString("")
+	require.NoError(t, err)
+	assert.Empty(t, r.MatchTrace("/", "bot"))
+}
+
+func TestCoverageReport(t *testing.T) {
+	t.Parallel()
+	r, err := FromString(robotsCaseExplain)
+	require.NoError(t, err)
+	report := r.CoverageReport([]string{
+		"/shop/cart/1",
+		"https://example.com/shop/cart/help?q=1",
+		"/shop",
+		"/about",
+		"http://[::1",
+	}, "bot")
+	require.Len(t, report, 5)
+	paths := make(map[string]string, len(report))
+	for u, rule := range report {
+		if rule != nil {
+			paths[u] = rule.String()
+		} else {
+			paths[u] = ""
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"/shop/cart/1":                           "Disallow: /shop/cart",
+		"https://example.com/shop/cart/help?q=1": "Allow: /shop/cart/help",
+		"/shop":                                  "Allow: /shop",
+		"/about":                                 "Disallow: /",
+		"http://[::1":                            "",
+	}, paths)
+
+	r, err = FromString("User-agent: bot\nDisallow: /private\n")
+	require.NoError(t, err)
+	report = r.CoverageReport([]string{"/public"}, "bot")
+	assert.Contains(t, report, "/public")
+	assert.Nil(t, report["/public"])
+}
+
+func TestAgentExplain(t *testing.T) {
+	t.Parallel()
+	r, err := FromString(robotsCaseExplain + "\nUser-agent: Googlebot\nDisallow: /private\n")
+	require.NoError(t, err)
+
+	allowed, group, rule := r.TestAgentExplain("/private/a", "Googlebot")
+	assert.False(t, allowed)
+	require.NotNil(t, group)
+	assert.Equal(t, "Googlebot", group.Agent)
+	require.NotNil(t, rule)
+	assert.True(t, rule == group.Rules[0])
+	assert.True(t, rule == group.FindRule("/private/a"))
+
+	allowed, group, rule = r.TestAgentExplain("/public", "Googlebot")
+	assert.True(t, allowed)
+	assert.NotNil(t, group)
+	assert.Nil(t, rule)
+
+	allowed, group, rule = r.TestAgentExplain("/shop/cart/help", "bot")
+	assert.True(t, allowed)
+	assert.Equal(t, "*", group.Agent)
+	assert.Equal(t, "Allow: /shop/cart/help", rule.String())
+
+	r, err = FromString("User-agent: a\nDisallow: /\n")
+	require.NoError(t, err)
+	allowed, group, rule = r.TestAgentExplain("/x", "b")
+	assert.True(t, allowed)
+	assert.Nil(t, group)
+	assert.Nil(t, rule)
+
+	r, err = FromStatusAndString(503, "")
+	require.NoError(t, err)
+	allowed, group, rule = r.TestAgentExplain("/x", "b")
+	assert.False(t, allowed)
+	assert.Nil(t, group)
+	assert.Nil(t, rule)
+}
+
+func TestExplain(t *testing.T) {
+	t.Parallel()
+	r, err := FromString(robotsCaseExplain + "\nUser-agent: Googlebot\nDisallow: /*.pdf$\n")
+	require.NoError(t, err)
+
+	m := r.Explain("/files/a.pdf", "Googlebot")
+	assert.False(t, m.Allowed)
+	assert.Equal(t, MatchedDisallow, m.Reason)
+	require.NotNil(t, m.Group)
+	assert.Equal(t, "Googlebot", m.Group.Agent)
+	assert.True(t, m.Rule == m.Group.Rules[0])
+	assert.Equal(t, m.Rule.Line, m.Line)
+	assert.NotZero(t, m.Line)
+	assert.Equal(t, MatchWildcard, m.Kind)
+	assert.Equal(t, "wildcard", m.Kind.String())
+
+	m = r.Explain("/shop/cart/help", "bot")
+	assert.True(t, m.Allowed)
+	assert.Equal(t, MatchedAllow, m.Reason)
+	assert.Equal(t, MatchPrefix, m.Kind)
+	assert.Equal(t, "Allow: /shop/cart/help", m.Rule.String())
+
+	m = r.Explain("/files/a.pdf?x", "Googlebot")
+	assert.True(t, m.Allowed)
+	assert.Equal(t, DefaultAllow, m.Reason)
+	assert.Nil(t, m.Rule)
+	assert.Zero(t, m.Line)
+	assert.Equal(t, MatchNone, m.Kind)
+
+	rule, allowed := m.Group.MatchedRule("/x.pdf")
+	assert.False(t, allowed)
+	assert.True(t, rule == m.Group.Rules[0])
+	rule, allowed = m.Group.MatchedRule("/x.html")
+	assert.True(t, allowed)
+	assert.Nil(t, rule)
+
+	r, err = FromStatusAndString(503, "")
+	require.NoError(t, err)
+	m = r.Explain("/x", "bot")
+	assert.Equal(t, MatchResult{Reason: DisallowAll}, m)
+}
+
+func TestRuleAtLine(t *testing.T) {
+	t.Parallel()
+	r, err := FromString(robotsCaseExplain + "\n# end\nUser-agent: a\nUser-agent: b\nCrawl-delay: 1\nDisallow: /ab\n")
+	require.NoError(t, err)
+	cases := map[int]string{
+		0:  "",
+		1:  "",
+		2:  "Disallow: /",
+		4:  "Disallow: /shop/cart",
+		6:  "Allow: /shop/cart/help",
+		7:  "",
+		11: "",
+		12: "Disallow: /ab",
+		13: "",
+	}
+	for line, expect := range cases {
+		rule := r.RuleAtLine(line)
+		if expect == "" {
+			assert.Nil(t, rule, "line %d", line)
+		} else if assert.NotNil(t, rule, "line %d", line) {
+			assert.Equal(t, expect, rule.String(), "line %d", line)
+		}
+	}
+	assert.True(t, r.RuleAtLine(12) == r.FindGroup("b").Rules[0])
+}
+
+func TestReasonCode(t *testing.T) {
+	t.Parallel()
+	r, err := FromString("User-agent: *\nDisallow: /private\nAllow: /private/public\n")
+	require.NoError(t, err)
+	cases := []struct {
+		path string
+		code ReasonCode
+	}{
+		{"/private/page", MatchedDisallow},
+		{"/private/public", MatchedAllow},
+		{"/other", DefaultAllow},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.code, r.TestReasonCode(c.path, "bot"), c.path)
+		assert.Equal(t, c.code != MatchedDisallow, r.TestAgent(c.path, "bot"), c.path)
+	}
+
+	r, err = FromStatusAndString(404, "")
+	require.NoError(t, err)
+	assert.Equal(t, AllowAll, r.TestReasonCode("/", "bot"))
+	r, err = FromStatusAndString(503, "")
+	require.NoError(t, err)
+	assert.Equal(t, DisallowAll, r.TestReasonCode("/", "bot"))
+
+	assert.Equal(t, "matched-disallow", MatchedDisallow.String())
+	assert.Equal(t, "unknown", ReasonCode(99).String())
+}
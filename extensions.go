@@ -0,0 +1,72 @@
+package robotstxt
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// CleanParam is a nonstandard Clean-param directive, as used by Yandex:
+// the URL parameters, such as session ids or referrers, that do not change
+// the content of the pages under Path, so crawlers may drop them.
+type CleanParam struct {
+	Params []string
+	Path   string // Prefix of the URL paths concerned, "/" if not given
+}
+
+func (cp CleanParam) String() string {
+	s := strings.Join(cp.Params, "&")
+	if cp.Path != "/" {
+		s += " " + cp.Path
+	}
+	return s
+}
+
+// Clean returns u without the query parameters cp drops, if cp applies to
+// its path. u is not modified.
+func (cp CleanParam) Clean(u *url.URL) *url.URL {
+	if !strings.HasPrefix(requestPath(u), cp.Path) || u.RawQuery == "" {
+		return u
+	}
+	q := u.Query()
+	for _, p := range cp.Params {
+		q.Del(p)
+	}
+	c := *u
+	c.RawQuery = q.Encode()
+	return &c
+}
+
+// parseCleanParam parses a Clean-param value: parameter names separated by
+// "&", optionally followed by whitespace and a path prefix.
+func parseCleanParam(v string) (CleanParam, error) {
+	fields := strings.Fields(v)
+	if len(fields) == 0 || len(fields) > 2 {
+		return CleanParam{}, fmt.Errorf("Clean-param invalid value '%s'", v)
+	}
+	cp := CleanParam{Path: "/"}
+	for _, name := range strings.Split(fields[0], "&") {
+		if name == "" || strings.ContainsAny(name, "=?/#") {
+			return CleanParam{}, fmt.Errorf("Clean-param invalid parameter '%s'", name)
+		}
+		cp.Params = append(cp.Params, name)
+	}
+	if len(fields) == 2 {
+		cp.Path = fields[1]
+		if !strings.HasPrefix(cp.Path, "/") {
+			cp.Path = "/" + cp.Path
+		}
+	}
+	return cp, nil
+}
+
+// Noindexed reports whether a Noindex rule of g matches path.
+func (g *Group) Noindexed(path string) bool {
+	path = g.subject(path)
+	for _, r := range g.Noindex {
+		if r.specificity(path) > 0 {
+			return true
+		}
+	}
+	return false
+}
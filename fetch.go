@@ -0,0 +1,266 @@
+package robotstxt
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheLifetime is how long a Fetcher keeps a robots.txt when the
+// response does not say otherwise. RFC 9309 asks crawlers not to use a
+// cached robots.txt for more than 24 hours.
+const DefaultCacheLifetime = 24 * time.Hour
+
+// DefaultRetryBackoff is how long a Fetcher waits after a first failure to
+// get a robots.txt before trying again, unless the response had a
+// Retry-After header. The wait doubles with each further failure, up to the
+// cache lifetime.
+const DefaultRetryBackoff = time.Minute
+
+// Fetcher fetches, parses and caches the robots.txt of each origin, so that
+// crawlers can test URLs without managing robots.txt themselves. A Fetcher
+// is safe for concurrent use.
+//
+// A robots.txt is kept for the lifetime given by the Cache-Control max-age
+// or Expires headers of the response, at most DefaultCacheLifetime or the
+// age set with WithMaxAge. When it cannot be fetched again because of a
+// network error or a 5xx status, the stale copy is used, as RFC 9309 allows.
+// Failures are cached too, for the Retry-After delay of the response or a
+// backoff starting at DefaultRetryBackoff, so that an origin in trouble is
+// not asked again for each URL tested. A request given up because its
+// context was canceled or expired is not a failure of the origin, its error
+// is returned but not cached.
+type Fetcher struct {
+	client  *http.Client
+	opts    ParseOptions
+	maxAge  time.Duration
+	backoff time.Duration
+	agent   string
+	now     func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]*fetchEntry
+}
+
+type fetchEntry struct {
+	data     *RobotsData
+	err      error
+	expires  time.Time
+	failures int // Consecutive failures to fetch
+}
+
+// Option configures a Fetcher.
+type Option func(*Fetcher)
+
+// WithParseOptions sets the options robots.txt files are parsed with.
+// Base is ignored, relative Sitemap URLs are resolved against the URL of
+// each robots.txt.
+func WithParseOptions(opts ParseOptions) Option {
+	return func(f *Fetcher) { f.opts = opts }
+}
+
+// WithMaxAge sets the longest time a robots.txt is cached, instead of
+// DefaultCacheLifetime.
+func WithMaxAge(d time.Duration) Option {
+	return func(f *Fetcher) { f.maxAge = d }
+}
+
+// WithRetryBackoff sets the wait after a first failure to get a robots.txt,
+// instead of DefaultRetryBackoff.
+func WithRetryBackoff(d time.Duration) Option {
+	return func(f *Fetcher) { f.backoff = d }
+}
+
+// WithUserAgent sets the User-Agent header of robots.txt requests.
+func WithUserAgent(agent string) Option {
+	return func(f *Fetcher) { f.agent = agent }
+}
+
+// NewFetcher returns a Fetcher using client, http.DefaultClient if nil.
+func NewFetcher(client *http.Client, opts ...Option) *Fetcher {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	f := &Fetcher{
+		client:  client,
+		maxAge:  DefaultCacheLifetime,
+		backoff: DefaultRetryBackoff,
+		now:     time.Now,
+		cache:   make(map[string]*fetchEntry),
+	}
+	for _, o := range opts {
+		o(f)
+	}
+	return f
+}
+
+// Test reports whether agent may fetch rawURL, an absolute URL, according
+// to the robots.txt of its origin.
+func (f *Fetcher) Test(ctx context.Context, rawURL, agent string) (bool, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false, err
+	}
+	r, err := f.get(ctx, u)
+	if err != nil {
+		return false, err
+	}
+	return r.TestAgentURL(u, agent), nil
+}
+
+// Get returns the robots.txt data of the origin of rawURL, fetching it if
+// it is not cached or has expired.
+func (f *Fetcher) Get(ctx context.Context, rawURL string) (*RobotsData, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return f.get(ctx, u)
+}
+
+// Forget drops the cached robots.txt of the origin of rawURL, if any.
+func (f *Fetcher) Forget(rawURL string) {
+	if u, err := url.Parse(rawURL); err == nil {
+		f.mu.Lock()
+		delete(f.cache, origin(u))
+		f.mu.Unlock()
+	}
+}
+
+func (f *Fetcher) get(ctx context.Context, u *url.URL) (*RobotsData, error) {
+	if !u.IsAbs() || u.Host == "" {
+		return nil, fmt.Errorf("robotstxt: %q is not an absolute URL", u)
+	}
+	key := origin(u)
+	now := f.now()
+	f.mu.Lock()
+	e := f.cache[key]
+	f.mu.Unlock()
+	if e != nil && now.Before(e.expires) {
+		return e.data, e.err
+	}
+
+	r, lifetime, err := f.fetch(ctx, key+"/robots.txt")
+	if err != nil && ctx.Err() != nil {
+		// The caller gave up, which tells nothing about the origin
+		return nil, err
+	}
+	if err != nil || r.DisallowAll {
+		// Unreachable, keep using the last good copy if any, else the
+		// failure, until the next try. A 5xx status disallowing everything
+		// is temporary, it does not replace a good copy.
+		failed := &fetchEntry{data: r, err: err, failures: 1}
+		if e != nil {
+			failed.failures = e.failures + 1
+			if e.err == nil && e.data != nil && !e.data.DisallowAll {
+				failed.data, failed.err = e.data, nil
+			}
+		}
+		failed.expires = now.Add(f.retryAfter(r, failed.failures))
+		f.mu.Lock()
+		f.cache[key] = failed
+		f.mu.Unlock()
+		return failed.data, failed.err
+	}
+	f.mu.Lock()
+	if lifetime > 0 {
+		f.cache[key] = &fetchEntry{data: r, expires: now.Add(lifetime)}
+	} else {
+		delete(f.cache, key)
+	}
+	f.mu.Unlock()
+	return r, nil
+}
+
+// retryAfter returns how long to wait before fetching again after the given
+// number of consecutive failures, the last one giving r.
+func (f *Fetcher) retryAfter(r *RobotsData, failures int) time.Duration {
+	if r != nil && r.RetryAfter > 0 {
+		return minDuration(r.RetryAfter, f.maxAge)
+	}
+	d := f.backoff
+	for i := 1; i < failures && d < f.maxAge; i++ {
+		d *= 2
+	}
+	return minDuration(d, f.maxAge)
+}
+
+// fetch gets and parses robotsURL, and returns how long the result may be
+// cached.
+func (f *Fetcher) fetch(ctx context.Context, robotsURL string) (*RobotsData, time.Duration, error) {
+	req, err := http.NewRequest("GET", robotsURL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if f.agent != "" {
+		req.Header.Set("User-Agent", f.agent)
+	}
+	client := f.client
+	if limit := f.opts.StatusPolicy.MaxRedirects; limit > 0 {
+		c := *client
+		c.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if len(via) > limit {
+				// Return the redirect, FromResponse applies the policy
+				return http.ErrUseLastResponse
+			}
+			return nil
+		}
+		client = &c
+	}
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Body.Close()
+	opts := f.opts
+	opts.Base = nil
+	r, err := FromResponseWithOptions(res, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	return r, f.lifetime(res.Header), nil
+}
+
+// lifetime returns how long a response with header h may be cached, at most
+// f.maxAge.
+func (f *Fetcher) lifetime(h http.Header) time.Duration {
+	d := f.maxAge
+	cc := strings.ToLower(h.Get("Cache-Control"))
+	for _, directive := range strings.Split(cc, ",") {
+		directive = strings.TrimSpace(directive)
+		switch {
+		case directive == "no-store" || directive == "no-cache":
+			return 0
+		case strings.HasPrefix(directive, "max-age="):
+			if secs, err := strconv.Atoi(directive[len("max-age="):]); err == nil {
+				return minDuration(time.Duration(secs)*time.Second, d)
+			}
+		}
+	}
+	if exp := h.Get("Expires"); exp != "" {
+		t, err := http.ParseTime(exp)
+		if err != nil {
+			// An invalid date means already expired
+			return 0
+		}
+		return minDuration(t.Sub(f.now()), d)
+	}
+	return d
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// origin returns the scheme and host of u, "https://example.com".
+func origin(u *url.URL) string {
+	return strings.ToLower(u.Scheme) + "://" + strings.ToLower(u.Host)
+}
@@ -0,0 +1,262 @@
+package robotstxt
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTransport answers requests with the responses set for their URL and
+// counts them.
+type fakeTransport struct {
+	responses map[string]*http.Response
+	requests  map[string]int
+	err       error
+}
+
+func (t *fakeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests[req.URL.String()]++
+	if t.err != nil {
+		return nil, t.err
+	}
+	res, ok := t.responses[req.URL.String()]
+	if !ok {
+		res = &http.Response{StatusCode: 404, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader(""))}
+	}
+	c := *res
+	c.Request = req
+	return &c, nil
+}
+
+func newFakeFetcher(t *fakeTransport, opts ...Option) (*Fetcher, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f := NewFetcher(&http.Client{Transport: t}, opts...)
+	f.now = func() time.Time { return now }
+	return f, &now
+}
+
+func fakeResponse(status int, body string, header http.Header) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{StatusCode: status, Header: header, Body: ioutil.NopCloser(strings.NewReader(body))}
+}
+
+func TestFetcher(t *testing.T) {
+	t.Parallel()
+	tr := &fakeTransport{
+		responses: map[string]*http.Response{
+			"https://example.com/robots.txt": fakeResponse(200, "User-agent: *\nDisallow: /private\n", nil),
+		},
+		requests: map[string]int{},
+	}
+	f, now := newFakeFetcher(tr)
+	ctx := context.Background()
+
+	allowed, err := f.Test(ctx, "https://example.com/private/page", "bot")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	allowed, err = f.Test(ctx, "https://Example.com/public?q=1", "bot")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	assert.Equal(t, 1, tr.requests["https://example.com/robots.txt"])
+
+	// Other origins have their own robots.txt
+	allowed, err = f.Test(ctx, "http://example.com/private", "bot")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	assert.Equal(t, 1, tr.requests["http://example.com/robots.txt"])
+
+	// Refetched once the default lifetime is over
+	*now = now.Add(DefaultCacheLifetime)
+	_, err = f.Test(ctx, "https://example.com/", "bot")
+	require.NoError(t, err)
+	assert.Equal(t, 2, tr.requests["https://example.com/robots.txt"])
+
+	f.Forget("https://example.com/any")
+	_, err = f.Get(ctx, "https://example.com/")
+	require.NoError(t, err)
+	assert.Equal(t, 3, tr.requests["https://example.com/robots.txt"])
+
+	_, err = f.Test(ctx, "/relative", "bot")
+	require.Error(t, err)
+}
+
+func TestFetcherLifetime(t *testing.T) {
+	t.Parallel()
+	f := NewFetcher(nil, WithMaxAge(time.Hour))
+	f.now = func() time.Time { return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC) }
+	cases := []struct {
+		header   http.Header
+		lifetime time.Duration
+	}{
+		{http.Header{}, time.Hour},
+		{http.Header{"Cache-Control": {"public, max-age=600"}}, 10 * time.Minute},
+		{http.Header{"Cache-Control": {"max-age=86400"}}, time.Hour},
+		{http.Header{"Cache-Control": {"no-cache"}}, 0},
+		{http.Header{"Expires": {"Mon, 01 Jan 2024 00:30:00 GMT"}}, 30 * time.Minute},
+		{http.Header{"Expires": {"0"}}, 0},
+		{http.Header{"Cache-Control": {"max-age=60"}, "Expires": {"Mon, 01 Jan 2024 00:30:00 GMT"}}, time.Minute},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.lifetime, f.lifetime(c.header), "%v", c.header)
+	}
+}
+
+func TestFetcherUnreachable(t *testing.T) {
+	t.Parallel()
+	tr := &fakeTransport{
+		responses: map[string]*http.Response{
+			"https://example.com/robots.txt": fakeResponse(200, "User-agent: *\nDisallow: /private\n",
+				http.Header{"Cache-Control": {"max-age=60"}}),
+		},
+		requests: map[string]int{},
+	}
+	f, now := newFakeFetcher(tr, WithUserAgent("bot/1.0"))
+	ctx := context.Background()
+	allowed, err := f.Test(ctx, "https://example.com/public", "bot")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	// A server error keeps the stale copy in use
+	*now = now.Add(time.Minute)
+	tr.responses["https://example.com/robots.txt"] = fakeResponse(503, "", nil)
+	allowed, err = f.Test(ctx, "https://example.com/public", "bot")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	assert.Equal(t, 2, tr.requests["https://example.com/robots.txt"])
+
+	// So does a network error
+	tr.err = errors.New("connection refused")
+	allowed, err = f.Test(ctx, "https://example.com/private", "bot")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+
+	// Without a copy the error is returned, a 5xx status disallows all
+	_, err = f.Test(ctx, "https://other.example/", "bot")
+	require.Error(t, err)
+	tr.err = nil
+	tr.responses["https://other.example/robots.txt"] = fakeResponse(500, "", nil)
+	*now = now.Add(DefaultRetryBackoff)
+	allowed, err = f.Test(ctx, "https://other.example/", "bot")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+}
+
+func TestFetcherCanceled(t *testing.T) {
+	t.Parallel()
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+	}))
+	defer srv.Close()
+	f := NewFetcher(srv.Client())
+
+	// A canceled request is not cached as a failure of the origin
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := f.Test(ctx, srv.URL+"/private", "bot")
+	require.Error(t, err)
+	allowed, err := f.Test(context.Background(), srv.URL+"/private", "bot")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&hits))
+}
+
+func TestFetcherBackoff(t *testing.T) {
+	t.Parallel()
+	const robotsURL = "https://example.com/robots.txt"
+	tr := &fakeTransport{
+		responses: map[string]*http.Response{robotsURL: fakeResponse(503, "", nil)},
+		requests:  map[string]int{},
+	}
+	f, now := newFakeFetcher(tr)
+	ctx := context.Background()
+	test := func(n int) {
+		for i := 0; i < n; i++ {
+			allowed, err := f.Test(ctx, "https://example.com/page", "bot")
+			require.NoError(t, err)
+			assert.False(t, allowed)
+		}
+	}
+
+	// The failure is kept for the backoff, doubling with each failure
+	test(5)
+	assert.Equal(t, 1, tr.requests[robotsURL])
+	*now = now.Add(DefaultRetryBackoff)
+	test(5)
+	assert.Equal(t, 2, tr.requests[robotsURL])
+	*now = now.Add(DefaultRetryBackoff)
+	test(1)
+	assert.Equal(t, 2, tr.requests[robotsURL])
+	*now = now.Add(DefaultRetryBackoff)
+	test(1)
+	assert.Equal(t, 3, tr.requests[robotsURL])
+
+	// Retry-After sets the wait
+	tr.responses[robotsURL] = fakeResponse(503, "", http.Header{"Retry-After": {"600"}})
+	*now = now.Add(4 * DefaultRetryBackoff)
+	test(1)
+	assert.Equal(t, 4, tr.requests[robotsURL])
+	*now = now.Add(9 * time.Minute)
+	test(1)
+	assert.Equal(t, 4, tr.requests[robotsURL])
+
+	// A stale copy keeps being used without refetching each time
+	tr.responses[robotsURL] = fakeResponse(200, "User-agent: *\nDisallow: /private\n",
+		http.Header{"Cache-Control": {"max-age=60"}})
+	*now = now.Add(time.Minute)
+	allowed, err := f.Test(ctx, "https://example.com/page", "bot")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	tr.err = errors.New("connection refused")
+	*now = now.Add(time.Minute)
+	for i := 0; i < 5; i++ {
+		allowed, err = f.Test(ctx, "https://example.com/page", "bot")
+		require.NoError(t, err)
+		assert.True(t, allowed)
+	}
+	assert.Equal(t, 6, tr.requests[robotsURL])
+}
+
+func TestFetcherRedirects(t *testing.T) {
+	t.Parallel()
+	redirect := func(to string) *http.Response {
+		return fakeResponse(301, "", http.Header{"Location": {to}})
+	}
+	tr := &fakeTransport{
+		responses: map[string]*http.Response{
+			"https://a.example/robots.txt": redirect("https://a.example/1"),
+			"https://a.example/1":          redirect("https://a.example/2"),
+			"https://a.example/2":          fakeResponse(200, "User-agent: *\nDisallow: /\n", nil),
+			"https://b.example/robots.txt": redirect("https://b.example/1"),
+			"https://b.example/1":          redirect("https://b.example/2"),
+			"https://b.example/2":          redirect("https://b.example/3"),
+			"https://b.example/3":          fakeResponse(200, "User-agent: *\nDisallow: /\n", nil),
+		},
+		requests: map[string]int{},
+	}
+	f, _ := newFakeFetcher(tr, WithParseOptions(ParseOptions{
+		StatusPolicy: StatusPolicy{MaxRedirects: 2, Redirect: StatusAllowAll},
+	}))
+	ctx := context.Background()
+	allowed, err := f.Test(ctx, "https://a.example/page", "bot")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+
+	// The third redirect is not followed
+	allowed, err = f.Test(ctx, "https://b.example/page", "bot")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+	assert.Zero(t, tr.requests["https://b.example/3"])
+}
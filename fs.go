@@ -0,0 +1,16 @@
+//go:build go1.16
+// +build go1.16
+
+package robotstxt
+
+import "io/fs"
+
+// FromFS parses the robots.txt file name in fsys, for example an embed.FS
+// holding test fixtures. Errors reading the file are returned as is.
+func FromFS(fsys fs.FS, name string) (*RobotsData, error) {
+	body, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	return FromBytes(body)
+}
@@ -0,0 +1,32 @@
+//go:build go1.16
+// +build go1.16
+
+package robotstxt
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFromFS(t *testing.T) {
+	t.Parallel()
+	fsys := fstest.MapFS{
+		"example.com/robots.txt": {Data: []byte("User-agent: *\nDisallow: /private\n")},
+		"empty/robots.txt":       {Data: []byte{}},
+	}
+	r, err := FromFS(fsys, "example.com/robots.txt")
+	require.NoError(t, err)
+	expectAccess(t, r, false, "/private", "bot")
+	expectAccess(t, r, true, "/public", "bot")
+
+	r, err = FromFS(fsys, "empty/robots.txt")
+	require.NoError(t, err)
+	expectAll(t, r, true)
+
+	_, err = FromFS(fsys, "missing/robots.txt")
+	assert.True(t, err != nil && err.(*fs.PathError).Err == fs.ErrNotExist, "%v", err)
+}
@@ -0,0 +1,68 @@
+package robotstxt
+
+// GoogleTest reports whether path is allowed for agent, matching the rules
+// of the group FindGroup selects the way Google's reference parser does,
+// rather than through the wildcard matcher of each rule. It serves as a
+// reference to compare TestAgent against:
+//
+//   - "*" matches any sequence of characters, "$" anchors the end of the
+//     path only when it ends the rule, elsewhere it is a literal "$".
+//   - The matching rule with the longest path wins, "*" and "$" counting as
+//     one character.
+//   - An Allow rule wins over an equally long Disallow rule.
+//
+// Trailing "*" are dropped from rule paths when parsing, so a rule written
+// with them ranks as if they were not there.
+func (r *RobotsData) GoogleTest(path, agent string) bool {
+	if r.AllowAll {
+		return true
+	}
+	if r.DisallowAll {
+		return false
+	}
+	g := r.FindGroup(agent)
+	path = g.subject(path)
+	allow, disallow := 0, 0
+	for _, rule := range g.Rules {
+		if !googleMatch(path, rule.Path) {
+			continue
+		}
+		switch n := len(rule.Path); {
+		case rule.Allow && n > allow:
+			allow = n
+		case !rule.Allow && n > disallow:
+			disallow = n
+		}
+	}
+	return disallow <= allow
+}
+
+// googleMatch reports whether pattern matches the start of path, tracking
+// every position in path the pattern read so far can end at.
+func googleMatch(path, pattern string) bool {
+	pos := make([]int, 1, len(path)+1)
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '$' && i == len(pattern)-1:
+			return pos[len(pos)-1] == len(path)
+		case c == '*':
+			// Any position from the earliest one on
+			start := pos[0]
+			pos = pos[:0]
+			for p := start; p <= len(path); p++ {
+				pos = append(pos, p)
+			}
+		default:
+			next := pos[:0]
+			for _, p := range pos {
+				if p < len(path) && path[p] == c {
+					next = append(next, p+1)
+				}
+			}
+			if pos = next; len(pos) == 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -1,6 +1,8 @@
 package robotstxt
 
 import (
+	"net/http"
+	"net/url"
 	"strings"
 	"testing"
 	"time"
@@ -63,6 +65,40 @@ Disallow: /`
 	}
 }
 
+func TestAllowlist(t *testing.T) {
+	const robotsCaseAllowlist = `User-agent: *
+Disallow: /
+Allow: /blog
+Allow: /docs/
+Disallow: /docs/internal
+Allow: /docs/internal/public
+Allow: /$`
+
+	r, err := FromString(robotsCaseAllowlist)
+	require.NoError(t, err)
+	cases := []struct {
+		path  string
+		allow bool
+	}{
+		{"/", true},
+		{"/index.html", false},
+		{"/admin", false},
+		{"/blog", true},
+		{"/blog/2024/post", true},
+		{"/blogroll", true},
+		{"/docs", false},
+		{"/docs/", true},
+		{"/docs/guide", true},
+		{"/docs/internal", false},
+		{"/docs/internal/secret", false},
+		{"/docs/internal/public", true},
+		{"/docs/internal/public/page", true},
+	}
+	for _, c := range cases {
+		expectAccess(t, r, c.allow, c.path, "bot")
+	}
+}
+
 func TestSitemaps(t *testing.T) {
 	const robotsCaseSitemaps = `sitemap: http://test.com/a
 user-agent: a
@@ -77,6 +113,8 @@ disallow: /g`
 
 	r, err := FromString(robotsCaseSitemaps)
 	require.NoError(t, err)
+	assert.True(t, r.HasSitemaps())
+	assert.Equal(t, 3, r.SitemapCount())
 	if len(r.Sitemaps) != 3 {
 		for i, s := range r.Sitemaps {
 			t.Logf("Sitemap %d: %s", i, s)
@@ -85,6 +123,15 @@ disallow: /g`
 	}
 }
 
+func TestNoSitemaps(t *testing.T) {
+	for _, input := range []string{"", "user-agent: a\ndisallow: /c"} {
+		r, err := FromString(input)
+		require.NoError(t, err)
+		assert.False(t, r.HasSitemaps())
+		assert.Equal(t, 0, r.SitemapCount())
+	}
+}
+
 func TestCrawlDelays(t *testing.T) {
 	const robotsCaseDelays = `useragent: a
 # some comment : with colon
@@ -111,13 +158,252 @@ crawl-delay: 5`
 	}
 }
 
+func TestCrawlDelayOnly(t *testing.T) {
+	r, err := FromString("User-agent: *\nCrawl-delay: 5\n")
+	require.NoError(t, err)
+	g := r.FindGroup("bot")
+	assert.Equal(t, "*", g.Agent)
+	assert.Empty(t, g.Rules)
+	assert.Equal(t, 5*time.Second, g.CrawlDelay)
+	expectAll(t, r, true)
+}
+
+func TestCrawlDelayRange(t *testing.T) {
+	const robotsCaseRange = "user-agent: a\ncrawl-delay: 1-5\ndisallow: /c"
+
+	var log testLogger
+	r, err := FromBytesWithOptions([]byte(robotsCaseRange), ParseOptions{Logger: &log, Repair: true})
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, r.Groups["a"].CrawlDelay)
+	require.Len(t, log.messages, 1)
+	assert.Contains(t, log.messages[0], "range")
+
+	_, err = FromBytesWithOptions([]byte(robotsCaseRange), ParseOptions{Strict: true})
+	require.Error(t, err)
+
+	// Without Repair the line is skipped
+	r, err = FromString(robotsCaseRange)
+	require.NoError(t, err)
+	assert.Zero(t, r.Groups["a"].CrawlDelay)
+	require.Len(t, r.Warnings, 1)
+	assert.Equal(t, WarnMalformed, r.Warnings[0].Kind)
+}
+
+func TestCrawlDelayTrailingGarbage(t *testing.T) {
+	const robotsCaseGarbage = "user-agent: a\ncrawl-delay: 5 junk\ndisallow: /c"
+
+	var log testLogger
+	r, err := FromBytesWithOptions([]byte(robotsCaseGarbage), ParseOptions{Logger: &log, Repair: true})
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, r.Groups["a"].CrawlDelay)
+	require.Len(t, log.messages, 1)
+	assert.Contains(t, log.messages[0], "'junk'")
+	expectAccess(t, r, false, "/c", "a")
+
+	_, err = FromBytesWithOptions([]byte(robotsCaseGarbage), ParseOptions{Strict: true})
+	require.Error(t, err)
+}
+
+func TestCrawlDelayRequestsPerSecond(t *testing.T) {
+	const robotsCaseRPS = "user-agent: a\ncrawl-delay: 2rps\nuser-agent: b\ncrawl-delay: 0.5 RPS\n"
+
+	var log testLogger
+	r, err := FromBytesWithOptions([]byte(robotsCaseRPS), ParseOptions{Logger: &log, Repair: true})
+	require.NoError(t, err)
+	assert.Equal(t, 500*time.Millisecond, r.Groups["a"].CrawlDelay)
+	assert.Equal(t, 2*time.Second, r.Groups["b"].CrawlDelay)
+	require.Len(t, log.messages, 2)
+	assert.Contains(t, log.messages[0], "request rate")
+
+	_, err = FromBytesWithOptions([]byte(robotsCaseRPS), ParseOptions{Strict: true})
+	require.Error(t, err)
+}
+
+func TestCrawlDelayAgent(t *testing.T) {
+	const robotsCaseDelays = `user-agent: *
+crawl-delay: 10
+disallow: /private
+user-agent: a
+crawl-delay: 2
+user-agent: b
+disallow: /b`
+
+	r, err := FromString(robotsCaseDelays)
+	require.NoError(t, err)
+	d, ok := r.CrawlDelay("a")
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Second, d)
+	// The group of b has no Crawl-delay, the one of "*" does not apply
+	d, ok = r.CrawlDelay("b")
+	assert.False(t, ok)
+	assert.Equal(t, time.Duration(0), d)
+	d, _ = r.CrawlDelay("other")
+	assert.Equal(t, 10*time.Second, d)
+
+	r, err = FromStatusAndString(503, "")
+	require.NoError(t, err)
+	_, ok = r.CrawlDelay("a")
+	assert.False(t, ok)
+}
+
+func TestCrawlDelayLimit(t *testing.T) {
+	const robotsCaseLong = "user-agent: *\ncrawl-delay: 86400\nuser-agent: a\ncrawl-delay: 1e300\nuser-agent: b\ncrawl-delay: 0.25\n"
+
+	r, err := FromString(robotsCaseLong)
+	require.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, r.Groups["*"].CrawlDelay)
+	assert.True(t, r.Groups["a"].CrawlDelay > 0)
+	d, ok := r.CrawlDelay("bot")
+	assert.True(t, ok)
+	assert.Equal(t, DefaultMaxCrawlDelay, d)
+	d, _ = r.CrawlDelay("a")
+	assert.Equal(t, DefaultMaxCrawlDelay, d)
+	d, _ = r.CrawlDelay("b")
+	assert.Equal(t, 250*time.Millisecond, d)
+
+	r, err = FromBytesWithOptions([]byte(robotsCaseLong), ParseOptions{MaxCrawlDelay: time.Minute})
+	require.NoError(t, err)
+	d, _ = r.CrawlDelay("bot")
+	assert.Equal(t, time.Minute, d)
+	r, err = FromBytesWithOptions([]byte(robotsCaseLong), ParseOptions{MaxCrawlDelay: -1})
+	require.NoError(t, err)
+	d, _ = r.CrawlDelay("bot")
+	assert.Equal(t, 24*time.Hour, d)
+
+	// A 429 or 503 response gives its Retry-After
+	res := newHttpResponse(429, "")
+	res.Header = http.Header{"Retry-After": {"30"}}
+	r, err = FromResponseWithOptions(res, ParseOptions{StatusPolicy: StatusPolicy{RateLimited: StatusDisallowAll}})
+	require.NoError(t, err)
+	d, ok = r.CrawlDelay("bot")
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, d)
+	assert.Equal(t, 30*time.Second, r.CrawlDelayOr("bot", time.Minute))
+}
+
+func TestWithDefaultCrawlDelay(t *testing.T) {
+	const robotsCaseDelays = `user-agent: a
+crawl-delay: 2
+disallow: /a
+user-agent: b
+disallow: /b`
+
+	r, err := FromString(robotsCaseDelays)
+	require.NoError(t, err)
+	c := r.WithDefaultCrawlDelay(5 * time.Second)
+	assert.Equal(t, 2*time.Second, c.CrawlDelayOr("a", 0))
+	assert.Equal(t, 5*time.Second, c.CrawlDelayOr("b", 0))
+	assert.Equal(t, time.Duration(0), c.CrawlDelayOr("other", 0))
+	// The original is untouched
+	assert.Equal(t, time.Duration(0), r.CrawlDelayOr("b", 0))
+	assert.False(t, c.TestAgent("/b", "b"))
+
+	// The fallback group is the copy
+	r, err = FromBytesWithOptions([]byte("user-agent: b\ndisallow: /b\nuser-agent: a\ncrawl-delay: 2\n"), ParseOptions{FirstGroupAsDefault: true})
+	require.NoError(t, err)
+	c = r.WithDefaultCrawlDelay(5 * time.Second)
+	assert.Equal(t, 5*time.Second, c.CrawlDelayOr("other", 0))
+	assert.Equal(t, time.Duration(0), r.CrawlDelayOr("other", 0))
+}
+
+func TestCrawlDelayOr(t *testing.T) {
+	const robotsCaseDelays = `user-agent: a
+crawl-delay: 2
+disallow: /a
+user-agent: b
+disallow: /b`
+
+	r, err := FromString(robotsCaseDelays)
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Second, r.CrawlDelayOr("a", time.Minute))
+	assert.Equal(t, time.Minute, r.CrawlDelayOr("b", time.Minute))
+	assert.Equal(t, time.Minute, r.CrawlDelayOr("other", time.Minute))
+
+	r, err = FromString("")
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, r.CrawlDelayOr("a", time.Minute))
+}
+
 func TestWildcards(t *testing.T) {
 	const robotsCaseWildcards = `user-agent: *
 Disallow: /Path*l$`
 
 	r, err := FromString(robotsCaseWildcards)
 	require.NoError(t, err)
-	assert.Equal(t, "/Path.*l$", r.Groups["*"].Rules[0].Pattern.String())
+	assert.Nil(t, r.Groups["*"].Rules[0].Pattern)
+	expectAccess(t, r, false, "/Path/to/file.html", "bot")
+	expectAccess(t, r, true, "/Path/to/file.htm", "bot")
+
+	r, err = FromBytesWithOptions([]byte(robotsCaseWildcards), ParseOptions{CompilePatterns: true})
+	require.NoError(t, err)
+	assert.Equal(t, "^/Path.*l$", r.Groups["*"].Rules[0].Pattern.String())
+}
+
+func TestWildcardsEncoded(t *testing.T) {
+	const robotsCaseEncoded = `user-agent: *
+Disallow: /calendar/*/event-%20*
+Disallow: /files/*%2B*.tar.gz$
+Allow: /files/public%2F*`
+
+	r, err := FromString(robotsCaseEncoded)
+	require.NoError(t, err)
+	cases := []struct {
+		path  string
+		allow bool
+	}{
+		{"/calendar/2024/event-%20x", false},
+		{"/calendar/2024/05/event-%20", false},
+		{"/calendar/event-%20x", true},
+		{"/calendar/2024/event-x", true},
+		{"/calendar/2024/event-%2", true},
+		// A raw space is the same as "%20"
+		{"/calendar/2024/event- x", false},
+		{"/files/a%2Bb.tar.gz", false},
+		{"/files/a%2Bb.tar.gz.sig", true},
+		{"/files/a+b.tar.gz", true},
+		{"/files/aXtarXgz", true},
+		{"/files/public%2Fa%2Bb.tar.gz", false},
+	}
+	for _, c := range cases {
+		expectAccess(t, r, c.allow, c.path, "bot")
+	}
+}
+
+func TestAgentURL(t *testing.T) {
+	const robotsCaseEncodings = `user-agent: *
+disallow: /café
+disallow: /%7Euser
+disallow: /a%2Fb
+disallow: /my page
+disallow: /*?q=
+disallow: /$`
+	r, err := FromBytesWithOptions([]byte(robotsCaseEncodings), ParseOptions{Repair: true})
+	require.NoError(t, err)
+	cases := []struct {
+		url   string
+		allow bool
+	}{
+		{"https://example.com", false},
+		{"https://example.com/", false},
+		{"https://example.com/?x=1", true},
+		{"https://example.com/caf%C3%A9", false},
+		{"https://example.com/caf%c3%a9/menu", false},
+		{"https://example.com/café", false},
+		{"https://example.com/cafe", true},
+		{"https://example.com/~user", false},
+		{"https://example.com/%7euser/home", false},
+		{"https://example.com/a/b", true},
+		{"https://example.com/a%2fb", false},
+		{"https://example.com/my%20page", false},
+		{"https://example.com/my+page", true},
+		{"https://example.com/search?q=go", false},
+		{"https://example.com/search?p=go", true},
+	}
+	for _, c := range cases {
+		u, err := url.Parse(c.url)
+		require.NoError(t, err)
+		assert.Equal(t, c.allow, r.TestAgentURL(u, "bot"), c.url)
+	}
 }
 
 func TestURLMatching(t *testing.T) {
@@ -212,6 +498,34 @@ func TestURLMatching(t *testing.T) {
 	}
 }
 
+func TestPrecedenceGoogle(t *testing.T) {
+	cases := []struct {
+		robots string
+		path   string
+		allow  bool
+	}{
+		// Equally specific, the least restrictive rule wins
+		{"allow: /folder\ndisallow: /folder", "/folder/page", true},
+		{"disallow: /folder\nallow: /folder", "/folder/page", true},
+		{"allow: /page\ndisallow: /*.php$", "/page.php", false},
+		{"allow: /page\ndisallow: /*.php$", "/page.php5", true},
+		{"allow: /page\ndisallow: /*.php$", "/page", true},
+		// "*" and "$" count as one character
+		{"allow: /$\ndisallow: /", "/", true},
+		{"allow: /*.htm\ndisallow: /p*", "/page.htm", true},
+		{"allow: /a*\ndisallow: /a", "/ab", true},
+		{"allow: /a\ndisallow: /a*b", "/ab", false},
+		// Patterns match from the start of the path
+		{"disallow: /a*b", "/x/ab", true},
+		{"disallow: /*b", "/x/ab", false},
+	}
+	for _, c := range cases {
+		r, err := FromString("user-agent: *\n" + c.robots)
+		require.NoError(t, err)
+		assert.Equal(t, c.allow, r.TestAgent(c.path, "bot"), "%q path=%s", c.robots, c.path)
+	}
+}
+
 func TestURLPrecedence(t *testing.T) {
 	var ok bool
 
@@ -252,3 +566,195 @@ func TestURLPrecedence(t *testing.T) {
 		}
 	}
 }
+
+func TestGoogleTest(t *testing.T) {
+	t.Parallel()
+	// Examples from Google's robots.txt documentation
+	cases := []struct {
+		robots string
+		path   string
+		allow  bool
+	}{
+		{"allow: /p\ndisallow: /", "/page", true},
+		{"allow: /folder\ndisallow: /folder", "/folder/page", true},
+		{"allow: /page\ndisallow: /*.htm", "/page.htm", false},
+		{"allow: /page\ndisallow: /*.ph", "/page.php5", true},
+		{"allow: /$\ndisallow: /", "/", true},
+		{"allow: /$\ndisallow: /", "/page.htm", false},
+		{"disallow: /fish", "/fish.html", false},
+		{"disallow: /fish", "/catfish", true},
+		{"disallow: /fish/", "/fish", true},
+		{"disallow: /*.php", "/folder/any.php.file.html", false},
+		{"disallow: /*.php$", "/filename.php?parameters", true},
+		{"disallow: /*.php$", "/folder/filename.php", false},
+		{"disallow: /fish*.php", "/fishheads/catfish.php?parameters", false},
+		{"disallow: /fish*.php", "/Fish.PHP", true},
+		{"disallow: /a*b*c", "/axxbyyc", false},
+		{"disallow: /a*b*c", "/axxcyyb", true},
+	}
+	for _, c := range cases {
+		r, err := FromString("user-agent: *\n" + c.robots)
+		require.NoError(t, err)
+		assert.Equal(t, c.allow, r.GoogleTest(c.path, "bot"), "%q path=%s", c.robots, c.path)
+		assert.Equal(t, c.allow, r.TestAgent(c.path, "bot"), "%q path=%s", c.robots, c.path)
+	}
+
+	// "$" before the end of a rule is a literal
+	r, err := FromString("user-agent: *\ndisallow: /a$b\n")
+	require.NoError(t, err)
+	assert.False(t, r.GoogleTest("/a$b", "bot"))
+	assert.True(t, r.GoogleTest("/a", "bot"))
+
+	r, err = FromStatusAndString(503, "")
+	require.NoError(t, err)
+	assert.False(t, r.GoogleTest("/", "bot"))
+}
+
+func TestCrawlBudgetHint(t *testing.T) {
+	t.Parallel()
+	const robotsCaseBudget = `user-agent: a
+crawl-delay: 2
+request-rate: 1/5
+visit-time: 0600-0845
+disallow: /a
+
+user-agent: b
+crawl-delay: 10
+request-rate: 30/1m
+
+user-agent: c
+request-rate: 1/x
+visit-time: 25:00-0100
+disallow: /c
+`
+	var log testLogger
+	r, err := FromBytesWithOptions([]byte(robotsCaseBudget), ParseOptions{Logger: &log})
+	require.NoError(t, err)
+
+	a := r.Groups["a"]
+	assert.Equal(t, &RequestRate{Requests: 1, Per: 5 * time.Second}, a.RequestRate)
+	assert.Equal(t, &VisitTime{From: 6 * time.Hour, To: 8*time.Hour + 45*time.Minute}, a.VisitTime)
+	assert.Equal(t, CrawlBudget{Interval: 5 * time.Second, VisitTime: a.VisitTime}, r.CrawlBudgetHint("a"))
+	assert.True(t, a.VisitTime.Contains(time.Date(2024, 1, 1, 7, 0, 0, 0, time.UTC)))
+	assert.False(t, a.VisitTime.Contains(time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "user-agent:*\ncrawl-delay:2\nrequest-rate:1/5s\nvisit-time:0600-0845\ndisallow:/a\n", string(r.Subset("a").Minify()))
+
+	assert.Equal(t, CrawlBudget{Interval: 10 * time.Second}, r.CrawlBudgetHint("b"))
+	assert.Equal(t, 2*time.Second, r.Groups["b"].RequestRate.Interval())
+
+	// Malformed values are ignored, the group keeps its other members
+	assert.Nil(t, r.Groups["c"].RequestRate)
+	assert.Nil(t, r.Groups["c"].VisitTime)
+	assert.Equal(t, CrawlBudget{}, r.CrawlBudgetHint("c"))
+	expectAccess(t, r, false, "/c", "c")
+	assert.Len(t, log.messages, 2)
+
+	assert.Equal(t, CrawlBudget{}, r.CrawlBudgetHint("other"))
+}
+
+func TestVisitTimeMidnight(t *testing.T) {
+	t.Parallel()
+	vt, err := parseVisitTime("22:00-02:00")
+	require.NoError(t, err)
+	assert.Equal(t, "2200-0200", vt.String())
+	assert.True(t, vt.Contains(time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC)))
+	assert.True(t, vt.Contains(time.Date(2024, 1, 1, 1, 0, 0, 0, time.UTC)))
+	assert.False(t, vt.Contains(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)))
+}
+
+func TestNoindexCleanParam(t *testing.T) {
+	t.Parallel()
+	const robotsCaseExtensions = `User-agent: Yandex
+Disallow: /private
+Noindex: /drafts/
+Noindex: /*.tmp$
+Clean-param: ref&sid /forum/
+Clean-param: utm_source
+Clean-param: a=b
+Clean-param:
+
+User-agent: *
+Disallow: /drafts/x
+`
+
+	var log testLogger
+	r, err := FromBytesWithOptions([]byte(robotsCaseExtensions), ParseOptions{Logger: &log})
+	require.NoError(t, err)
+	assert.Equal(t, []CleanParam{
+		{Params: []string{"ref", "sid"}, Path: "/forum/"},
+		{Params: []string{"utm_source"}, Path: "/"},
+	}, r.CleanParams)
+	require.Len(t, r.Warnings, 1)
+	assert.Equal(t, WarnIgnoredValue, r.Warnings[0].Kind)
+	assert.Equal(t, 7, r.Warnings[0].Line)
+
+	g := r.FindGroup("Yandex")
+	require.Len(t, g.Noindex, 2)
+	assert.True(t, g.Noindexed("/drafts/1"))
+	assert.True(t, g.Noindexed("/a/b.tmp"))
+	assert.False(t, g.Noindexed("/a/b.tmp2"))
+	assert.False(t, g.Noindexed("/public"))
+	// Noindex does not affect crawling
+	expectAccess(t, r, true, "/drafts/1", "Yandex")
+	expectAccess(t, r, false, "/private", "Yandex")
+	assert.False(t, r.FindGroup("other").Noindexed("/drafts/1"))
+
+	u, err := url.Parse("https://example.com/forum/t?id=1&sid=abc&ref=x")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/forum/t?id=1", r.CleanParams[0].Clean(u).String())
+	assert.Equal(t, "https://example.com/forum/t?id=1&sid=abc&ref=x", u.String())
+	u, err = url.Parse("https://example.com/shop?sid=abc")
+	require.NoError(t, err)
+	assert.True(t, u == r.CleanParams[0].Clean(u))
+
+	s := r.String()
+	assert.Contains(t, s, "Noindex: /drafts/\nNoindex: /*.tmp$\n")
+	assert.Contains(t, s, "Clean-param: ref&sid /forum/\nClean-param: utm_source\n")
+	again, err := FromString(s)
+	require.NoError(t, err)
+	assert.Equal(t, r.Fingerprint(), again.Fingerprint())
+}
+
+func TestURL(t *testing.T) {
+	t.Parallel()
+	// Examples from RFC 9309, section 2.2.2
+	const robotsCaseRFC = `user-agent: *
+disallow: /foo/bar?baz=quz
+disallow: /foo/bar/%E3%83%84
+disallow: /foo/bar/ツ/x
+disallow: /foo/bar/%62%61%7A
+disallow: /path/file-with-a-%2A.html
+disallow: /path/foo-%24
+disallow: /a%2Fb`
+	r, err := FromString(robotsCaseRFC)
+	require.NoError(t, err)
+	cases := []struct {
+		url   string
+		allow bool
+	}{
+		{"https://example.com/foo/bar?baz=quz", false},
+		{"https://example.com/foo/bar?baz=other", true},
+		{"https://example.com/foo/bar/%E3%83%84", false},
+		{"https://example.com/foo/bar/ツ", false},
+		{"https://example.com/foo/bar/%E3%83%84/x", false},
+		{"https://example.com/foo/bar/baz", false},
+		{"https://example.com/foo/bar/%62az", false},
+		{"https://example.com/path/file-with-a-%2A.html", false},
+		{"https://example.com/path/file-with-a-x.html", true},
+		{"https://example.com/path/foo-%24", false},
+		{"https://example.com/path/foo-", true},
+		{"https://example.com/a%2fb", false},
+		{"https://example.com/a/b", true},
+		{"https://example.com", true},
+	}
+	for _, c := range cases {
+		u, err := url.Parse(c.url)
+		require.NoError(t, err)
+		assert.Equal(t, c.allow, r.TestURL(u, "bot"), c.url)
+		allow, err := r.TestURLString(c.url, "bot")
+		require.NoError(t, err)
+		assert.Equal(t, c.allow, allow, c.url)
+	}
+	_, err = r.TestURLString("http://%zz/", "bot")
+	require.Error(t, err)
+}
@@ -0,0 +1,328 @@
+package robotstxt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MergeStrategy decides how Merge combines the groups of an agent found in
+// both inputs.
+type MergeStrategy int
+
+const (
+	// MergeUnion keeps the rules of both groups, equivalent rules once, and
+	// the longest crawl delay. An Allow and a Disallow rule for equivalent
+	// paths are both kept, so the Allow rule wins.
+	MergeUnion MergeStrategy = iota
+
+	// MergeRestrictive is MergeUnion dropping the Allow rule of an Allow
+	// and a Disallow rule for equivalent paths.
+	MergeRestrictive
+
+	// MergePreferA and MergePreferB keep the group of a, respectively b,
+	// unchanged.
+	MergePreferA
+	MergePreferB
+)
+
+// Merge returns a new RobotsData holding the groups of a and b, combined
+// with strategy when both have a group for the same agent, the Host of a,
+// or else of b, and the Sitemaps and CleanParams of both. a and b are not
+// modified, the rules of the result have no source line. The group of the
+// agent a, or else b, falls back to (see ParseOptions.FirstGroupAsDefault) is
+// the fallback of the result too.
+//
+// AllowAll data counts as having no groups and DisallowAll data as having
+// a "*" group disallowing everything. A nil argument counts as AllowAll.
+func Merge(a, b *RobotsData, strategy MergeStrategy) *RobotsData {
+	a, b = asGroups(a), asGroups(b)
+	m := &RobotsData{
+		Groups:        make(map[string]*Group, len(a.Groups)+len(b.Groups)),
+		Host:          a.Host,
+		prefixAgents:  a.prefixAgents,
+		maxCrawlDelay: a.maxCrawlDelay,
+	}
+	if m.Host == "" {
+		m.Host = b.Host
+	}
+	m.Sitemaps = appendUnique(append([]string(nil), a.Sitemaps...), b.Sitemaps)
+	seen := make(map[string]bool)
+	for _, cp := range append(append([]CleanParam(nil), a.CleanParams...), b.CleanParams...) {
+		if s := cp.String(); !seen[s] {
+			seen[s] = true
+			m.CleanParams = append(m.CleanParams, cp)
+		}
+	}
+
+	for agent, ga := range a.Groups {
+		gb := b.Groups[agent]
+		switch {
+		case gb == nil || strategy == MergePreferA:
+			m.Groups[agent] = copyGroup(ga)
+		case strategy == MergePreferB:
+			m.Groups[agent] = copyGroup(gb)
+		default:
+			m.Groups[agent] = mergeGroups(ga, gb, strategy == MergeRestrictive)
+		}
+	}
+	for agent, gb := range b.Groups {
+		if a.Groups[agent] == nil {
+			m.Groups[agent] = copyGroup(gb)
+		}
+	}
+	for _, r := range []*RobotsData{a, b} {
+		if key, ok := r.defaultKey(); ok {
+			m.defaultGroup = m.Groups[key]
+			break
+		}
+	}
+	if len(m.Groups) == 0 {
+		m.Groups = nil
+		m.AllowAll = true
+	}
+	m.indexAgents()
+	return m
+}
+
+// defaultKey returns the first key of Groups holding r.defaultGroup, and
+// whether there is one.
+func (r *RobotsData) defaultKey() (string, bool) {
+	if r.defaultGroup == nil {
+		return "", false
+	}
+	for _, a := range r.agentNames() {
+		if r.Groups[a] == r.defaultGroup {
+			return a, true
+		}
+	}
+	return "", false
+}
+
+// asGroups returns r with the AllowAll and DisallowAll flags replaced by
+// the equivalent groups.
+func asGroups(r *RobotsData) *RobotsData {
+	switch {
+	case r == nil || r.AllowAll:
+		return &RobotsData{}
+	case r.DisallowAll:
+		return &RobotsData{Groups: map[string]*Group{"*": {Agent: "*", Agents: []string{"*"}, Rules: []*Rule{{Path: "/"}}}}}
+	}
+	return r
+}
+
+// copyGroup returns a copy of g whose rules have no source line.
+func copyGroup(g *Group) *Group {
+	c := *g
+	c.Agents = append([]string(nil), g.Agents...)
+	c.Rules = copyRules(nil, g.Rules, nil)
+	c.Noindex = copyRules(nil, g.Noindex, nil)
+	c.index = nil
+	return &c
+}
+
+// copyRules appends to dst copies of the rules of src, without source line,
+// that are not equivalent to a rule already in dst or rejected by skip.
+func copyRules(dst, src []*Rule, skip func(*Rule) bool) []*Rule {
+	seen := make(map[ruleKey]bool, len(dst)+len(src))
+	for _, r := range dst {
+		seen[r.key()] = true
+	}
+	for _, r := range src {
+		if k := r.key(); !seen[k] && (skip == nil || !skip(r)) {
+			seen[k] = true
+			c := *r
+			c.Line = 0
+			dst = append(dst, &c)
+		}
+	}
+	return dst
+}
+
+// mergeGroups returns the union of ga and gb. With restrictive, Allow
+// rules equivalent to a Disallow rule of either group are left out.
+func mergeGroups(ga, gb *Group, restrictive bool) *Group {
+	m := copyGroup(ga)
+	m.Agents = appendUnique(m.Agents, gb.Agents)
+	if gb.CrawlDelay > m.CrawlDelay {
+		m.CrawlDelay = gb.CrawlDelay
+	}
+	if m.RequestRate == nil {
+		m.RequestRate = gb.RequestRate
+	}
+	if m.VisitTime == nil {
+		m.VisitTime = gb.VisitTime
+	}
+	var skip func(*Rule) bool
+	if restrictive {
+		disallowed := make(map[string]bool)
+		for _, r := range append(append([]*Rule(nil), ga.Rules...), gb.Rules...) {
+			if !r.Allow {
+				disallowed[r.key().path] = true
+			}
+		}
+		skip = func(r *Rule) bool { return r.Allow && disallowed[r.key().path] }
+	}
+	m.Rules = copyRules(nil, append(append([]*Rule(nil), ga.Rules...), gb.Rules...), skip)
+	m.Noindex = copyRules(m.Noindex, gb.Noindex, nil)
+	return m
+}
+
+// ruleKey identifies rules matching the same paths with the same outcome.
+type ruleKey struct {
+	path  string
+	allow bool
+}
+
+// key returns the ruleKey of r: its path with repeated "*" collapsed and a
+// final "*" or "*$", which match whatever follows, removed.
+func (r *Rule) key() ruleKey {
+	path := r.Path
+	for strings.Contains(path, "**") {
+		path = strings.Replace(path, "**", "*", -1)
+	}
+	path = strings.TrimSuffix(strings.TrimSuffix(path, "*$"), "*")
+	if path == "" {
+		path = "/"
+	}
+	return ruleKey{path: path, allow: r.Allow}
+}
+
+// appendUnique appends to dst the strings of src it does not hold yet.
+func appendUnique(dst, src []string) []string {
+	seen := make(map[string]bool, len(dst)+len(src))
+	for _, s := range dst {
+		seen[s] = true
+	}
+	for _, s := range src {
+		if !seen[s] {
+			seen[s] = true
+			dst = append(dst, s)
+		}
+	}
+	return dst
+}
+
+// ChangeKind tells what a Change is about.
+type ChangeKind int
+
+const (
+	GroupAdded        ChangeKind = iota // A group for Agent was added
+	GroupRemoved                        // The group of Agent was removed
+	RuleAdded                           // Rule was added to the group of Agent
+	RuleRemoved                         // Rule was removed from the group of Agent
+	CrawlDelayChanged                   // The crawl delay of Agent changed from From to To
+	HostChanged                         // Host changed from From to To
+	SitemapAdded                        // Sitemap To was added
+	SitemapRemoved                      // Sitemap From was removed
+)
+
+// Change is a difference between two RobotsData found by Diff.
+type Change struct {
+	Kind     ChangeKind
+	Agent    string // Key in Groups, empty for Host and Sitemap changes
+	Rule     *Rule  // The rule added or removed
+	From, To string // The old and new values
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case GroupAdded:
+		return "+ User-agent: " + c.Agent
+	case GroupRemoved:
+		return "- User-agent: " + c.Agent
+	case RuleAdded:
+		return c.Agent + ": + " + c.Rule.String()
+	case RuleRemoved:
+		return c.Agent + ": - " + c.Rule.String()
+	case CrawlDelayChanged:
+		return fmt.Sprintf("%s: Crawl-delay %s -> %s", c.Agent, c.From, c.To)
+	case HostChanged:
+		return fmt.Sprintf("Host %q -> %q", c.From, c.To)
+	case SitemapAdded:
+		return "+ Sitemap: " + c.To
+	case SitemapRemoved:
+		return "- Sitemap: " + c.From
+	}
+	return fmt.Sprintf("unknown change %d", c.Kind)
+}
+
+// Diff returns the changes turning a into b, group by group in agent order,
+// then Host and Sitemaps changes. Rules are compared by meaning: equivalent
+// paths, such as "/a" and "/a*$", and repeated rules are the same, and the
+// order of rules and source lines are ignored. Rules of added and removed
+// groups are listed too. AllowAll and DisallowAll data, and nil, are
+// compared as Merge sees them.
+func Diff(a, b *RobotsData) []Change {
+	a, b = asGroups(a), asGroups(b)
+	var changes []Change
+	all := &RobotsData{Groups: make(map[string]*Group, len(a.Groups)+len(b.Groups))}
+	for agent, g := range a.Groups {
+		all.Groups[agent] = g
+	}
+	for agent, g := range b.Groups {
+		all.Groups[agent] = g
+	}
+	for _, agent := range all.agentNames() {
+		ga, gb := a.Groups[agent], b.Groups[agent]
+		switch {
+		case ga == nil:
+			changes = append(changes, Change{Kind: GroupAdded, Agent: agent})
+			ga = &Group{}
+		case gb == nil:
+			changes = append(changes, Change{Kind: GroupRemoved, Agent: agent})
+			gb = &Group{}
+		case ga.CrawlDelay != gb.CrawlDelay:
+			changes = append(changes, Change{
+				Kind:  CrawlDelayChanged,
+				Agent: agent,
+				From:  ga.CrawlDelay.String(),
+				To:    gb.CrawlDelay.String(),
+			})
+		}
+		changes = append(changes, ruleChanges(agent, ga.Rules, gb.Rules, RuleRemoved)...)
+		changes = append(changes, ruleChanges(agent, gb.Rules, ga.Rules, RuleAdded)...)
+	}
+	if a.Host != b.Host {
+		changes = append(changes, Change{Kind: HostChanged, From: a.Host, To: b.Host})
+	}
+	for _, s := range missing(a.Sitemaps, b.Sitemaps) {
+		changes = append(changes, Change{Kind: SitemapRemoved, From: s})
+	}
+	for _, s := range missing(b.Sitemaps, a.Sitemaps) {
+		changes = append(changes, Change{Kind: SitemapAdded, To: s})
+	}
+	return changes
+}
+
+// ruleChanges returns a change of kind for each rule of from without an
+// equivalent in to, once.
+func ruleChanges(agent string, from, to []*Rule, kind ChangeKind) []Change {
+	var changes []Change
+	seen := make(map[ruleKey]bool, len(to))
+	for _, r := range to {
+		seen[r.key()] = true
+	}
+	for _, r := range from {
+		if k := r.key(); !seen[k] {
+			seen[k] = true
+			changes = append(changes, Change{Kind: kind, Agent: agent, Rule: r})
+		}
+	}
+	return changes
+}
+
+// missing returns the strings of from that are not in to.
+func missing(from, to []string) []string {
+	in := make(map[string]bool, len(to))
+	for _, s := range to {
+		in[s] = true
+	}
+	var out []string
+	for _, s := range from {
+		if !in[s] {
+			in[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,124 @@
+package robotstxt
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	robotsMergeA = `User-agent: *
+Disallow: /private
+Allow: /private/ok
+Crawl-delay: 1
+
+User-agent: a
+Disallow: /a
+
+Sitemap: https://example.com/a.xml
+Host: example.com
+`
+	robotsMergeB = `User-agent: *
+Disallow: /private*$
+Disallow: /private/ok
+Disallow: /tmp
+Crawl-delay: 3
+
+User-agent: b
+Disallow: /b
+
+Sitemap: https://example.com/a.xml
+Sitemap: https://example.com/b.xml
+Host: www.example.com
+`
+)
+
+func TestMerge(t *testing.T) {
+	t.Parallel()
+	a, err := FromString(robotsMergeA)
+	require.NoError(t, err)
+	b, err := FromString(robotsMergeB)
+	require.NoError(t, err)
+
+	m := Merge(a, b, MergeUnion)
+	assert.Equal(t, "example.com", m.Host)
+	assert.Equal(t, []string{"https://example.com/a.xml", "https://example.com/b.xml"}, m.Sitemaps)
+	star := m.Groups["*"]
+	require.NotNil(t, star)
+	assert.Equal(t, []string{"Disallow: /private", "Allow: /private/ok", "Disallow: /private/ok", "Disallow: /tmp"}, ruleStrings(star))
+	assert.Equal(t, 3*time.Second, star.CrawlDelay)
+	for _, r := range star.Rules {
+		assert.Zero(t, r.Line)
+	}
+	expectAccess(t, m, true, "/private/ok", "bot")
+	expectAccess(t, m, false, "/tmp", "bot")
+	expectAccess(t, m, false, "/a", "a")
+	expectAccess(t, m, false, "/b", "b")
+	// The inputs are unchanged
+	assert.Len(t, a.Groups["*"].Rules, 2)
+	assert.Equal(t, time.Second, a.Groups["*"].CrawlDelay)
+
+	m = Merge(a, b, MergeRestrictive)
+	assert.Equal(t, []string{"Disallow: /private", "Disallow: /private/ok", "Disallow: /tmp"}, ruleStrings(m.Groups["*"]))
+	expectAccess(t, m, false, "/private/ok", "bot")
+
+	m = Merge(a, b, MergePreferA)
+	assert.Equal(t, ruleStrings(a.Groups["*"]), ruleStrings(m.Groups["*"]))
+	assert.Equal(t, time.Second, m.Groups["*"].CrawlDelay)
+	assert.NotNil(t, m.Groups["b"])
+	m = Merge(a, b, MergePreferB)
+	assert.Equal(t, ruleStrings(b.Groups["*"]), ruleStrings(m.Groups["*"]))
+
+	// AllowAll adds nothing, DisallowAll a "*" group disallowing everything
+	m = Merge(&RobotsData{AllowAll: true}, nil, MergeUnion)
+	assert.True(t, m.AllowAll)
+	m = Merge(a, &RobotsData{DisallowAll: true}, MergeUnion)
+	assert.Equal(t, []string{"Disallow: /private", "Allow: /private/ok", "Disallow: /"}, ruleStrings(m.Groups["*"]))
+	expectAccess(t, m, false, "/x", "bot")
+
+	// The group unknown agents fall back to is kept
+	c, err := FromBytesWithOptions([]byte("User-agent: c\nDisallow: /c\n"), ParseOptions{FirstGroupAsDefault: true})
+	require.NoError(t, err)
+	m = Merge(&RobotsData{Groups: map[string]*Group{"a": a.Groups["a"]}}, c, MergeUnion)
+	expectAccess(t, m, false, "/c", "other")
+	expectAccess(t, m, true, "/c", "a")
+}
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+	a, err := FromString(robotsMergeA)
+	require.NoError(t, err)
+	b, err := FromString(robotsMergeB)
+	require.NoError(t, err)
+
+	var got []string
+	for _, c := range Diff(a, b) {
+		got = append(got, c.String())
+	}
+	assert.Equal(t, []string{
+		"*: Crawl-delay 1s -> 3s",
+		"*: - Allow: /private/ok",
+		"*: + Disallow: /private/ok",
+		"*: + Disallow: /tmp",
+		"- User-agent: a",
+		"a: - Disallow: /a",
+		"+ User-agent: b",
+		"b: + Disallow: /b",
+		`Host "example.com" -> "www.example.com"`,
+		"+ Sitemap: https://example.com/b.xml",
+	}, got)
+
+	// Layout, order, repeated rules and equivalent wildcards do not matter
+	c, err := FromString("User-agent: a\nDisallow: /a**\nDisallow: /a\n\nuser-agent: *\nallow: /private/ok\ndisallow: /private\ncrawl-delay: 1\n\nSitemap: https://example.com/a.xml\nHost: example.com\n")
+	require.NoError(t, err)
+	assert.Empty(t, Diff(a, c))
+	assert.Empty(t, Diff(nil, &RobotsData{AllowAll: true}))
+
+	changes := Diff(nil, &RobotsData{DisallowAll: true})
+	require.Len(t, changes, 2)
+	assert.Equal(t, GroupAdded, changes[0].Kind)
+	assert.Equal(t, RuleAdded, changes[1].Kind)
+	assert.Equal(t, "/", changes[1].Rule.Path)
+}
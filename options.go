@@ -0,0 +1,290 @@
+package robotstxt
+
+import (
+	"net/url"
+	"time"
+)
+
+// Logger receives human readable diagnostics from the parser and the fetch
+// helpers. *log.Logger satisfies this interface.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// DefaultMaxGroups is the number of groups kept when ParseOptions.MaxGroups
+// is not set. Real files rarely name more than a few dozen agents.
+const DefaultMaxGroups = 10000
+
+// DefaultMaxWildcards is the number of "*" allowed in a rule path when
+// ParseOptions.MaxWildcards is not set.
+const DefaultMaxWildcards = 100
+
+// DefaultMaxParseBytes is the size robots.txt files are cut to when
+// ParseOptions.MaxParseBytes is not set: 500 KiB, the least RFC 9309 asks
+// crawlers to parse, and the limit of Google's crawler.
+const DefaultMaxParseBytes = 500 << 10
+
+// DefaultMaxAgentLength is the length past which User-agent values are
+// ignored when ParseOptions.MaxAgentLength is not set.
+const DefaultMaxAgentLength = 256
+
+// DefaultMaxCrawlDelay is the longest delay RobotsData.CrawlDelay returns
+// when ParseOptions.MaxCrawlDelay is not set. Longer delays, such as
+// "Crawl-delay: 86400", are unlikely to be meant, or honored, as written.
+const DefaultMaxCrawlDelay = 10 * time.Minute
+
+// MatchStrategy selects how the rule deciding a path is chosen among the
+// rules matching it.
+type MatchStrategy int
+
+const (
+	// MatchRFC9309 follows RFC 9309: the rule whose path has the most
+	// octets, percent-encoded characters counting as one and wildcards
+	// included, wins. An Allow rule wins over an equally long Disallow rule.
+	MatchRFC9309 MatchStrategy = iota
+
+	// MatchLegacy reproduces earlier versions of this package: rules with
+	// wildcards are ranked by the length of their regexp, and the rule
+	// listed first wins ties.
+	MatchLegacy
+)
+
+// StatusAction is how a class of HTTP status codes is interpreted.
+type StatusAction int
+
+const (
+	// StatusDefault keeps the interpretation of the package, see
+	// StatusPolicy.
+	StatusDefault StatusAction = iota
+
+	// StatusAllowAll reads the status as "there is no robots.txt",
+	// allowing everything, as RFC 9309 does for unavailable files.
+	StatusAllowAll
+
+	// StatusDisallowAll reads the status as "crawling is not possible now",
+	// disallowing everything.
+	StatusDisallowAll
+
+	// StatusError fails with an error.
+	StatusError
+)
+
+// StatusPolicy decides how responses other than 2xx are interpreted. Its
+// zero value is the policy of Google and RFC 9309: 4xx responses allow
+// everything, 5xx responses disallow everything and the 3xx responses of
+// redirects that were not followed are an error.
+type StatusPolicy struct {
+	// ClientError applies to 4xx statuses but 429.
+	ClientError StatusAction
+
+	// ServerError applies to 5xx statuses but 503.
+	ServerError StatusAction
+
+	// RateLimited applies to 429 Too Many Requests and 503 Service
+	// Unavailable. By default they are read as the other statuses of
+	// their class, StatusDisallowAll gives crawlers a consistent "come back
+	// later" for both. Either way their Retry-After header is kept in
+	// RobotsData.RetryAfter by FromResponse.
+	RateLimited StatusAction
+
+	// Redirect applies to 3xx statuses, and to responses reached through
+	// more than MaxRedirects redirects.
+	Redirect StatusAction
+
+	// MaxRedirects, if positive, is the number of redirects a Fetcher
+	// follows to get a robots.txt, and that FromResponse accepts in the
+	// chain of requests leading to a response. RFC 9309 asks crawlers to
+	// follow at least five.
+	MaxRedirects int
+}
+
+// action returns the action for statusCode, or StatusDefault if p does not
+// set one.
+func (p *StatusPolicy) action(statusCode int) StatusAction {
+	switch {
+	case statusCode == 429 || statusCode == 503:
+		if p.RateLimited != StatusDefault {
+			return p.RateLimited
+		}
+	case statusCode >= 300 && statusCode < 400:
+		return p.Redirect
+	}
+	switch {
+	case statusCode >= 400 && statusCode < 500:
+		return p.ClientError
+	case statusCode >= 500 && statusCode < 600:
+		return p.ServerError
+	}
+	return StatusDefault
+}
+
+// ParseOptions controls optional parser behaviour.
+// FromBytes is equivalent to parsing with ParseOptions{}.
+type ParseOptions struct {
+	// Strict makes any malformed line fail the whole parse with a
+	// *ParseError. Otherwise parsing is lenient: malformed lines are
+	// logged, skipped and listed in RobotsData.Warnings.
+	Strict bool
+
+	// Repair makes lenient parsing read some common mistakes the way their
+	// author most likely meant them, instead of skipping the lines: group
+	// members before any User-agent apply to all agents, comma-separated
+	// User-agent values name several agents, Crawl-delay values such as
+	// "2rps", "5 seconds" or "1-5" are read, whitespace in rule paths is
+	// percent-encoded and Unicode whitespace separates values. Each
+	// reinterpretation is listed in RobotsData.Warnings. It has no effect
+	// on strict parsing.
+	Repair bool
+
+	// Logger receives messages about truncated input, bodies that look
+	// like HTML, redirects and ignored lines. Nil disables logging.
+	Logger Logger
+
+	// Base, if set, is used to resolve relative Sitemap URLs.
+	Base *url.URL
+
+	// MaxBytes, if positive, makes FromResponseWithOptions and the
+	// FromReader functions fail with ErrBodyTooLarge as soon as more of the
+	// body has been read.
+	MaxBytes int64
+
+	// MaxParseBytes limits the size of the robots.txt parsed, the content
+	// after the last full line within the limit is ignored, and recorded
+	// in Warnings as WarnTruncated. Readers are not read past the limit
+	// unless MaxBytes asks to check the size of the rest. Zero means
+	// DefaultMaxParseBytes, a negative value no limit.
+	MaxParseBytes int64
+
+	// MaxGroups limits the number of distinct user-agent groups. Agents
+	// beyond the limit are ignored, groups already created keep collecting
+	// rules. Zero means DefaultMaxGroups.
+	MaxGroups int
+
+	// MaxAgentLength limits the length of User-agent values. A longer one
+	// is an error in strict mode, otherwise it is ignored like an empty
+	// User-agent: alone in its block, the rules following it apply to no
+	// agent. Zero means DefaultMaxAgentLength.
+	MaxAgentLength int
+
+	// MaxWildcards limits the number of "*" in a rule path, bounding the
+	// cost of matching it. A longer pattern is cut at its first wildcard
+	// and used as a plain path prefix. Zero means DefaultMaxWildcards.
+	MaxWildcards int
+
+	// MaxCrawlDelay limits the delay RobotsData.CrawlDelay returns, longer
+	// Crawl-delay and Retry-After values are cut to it. Group.CrawlDelay
+	// keeps the value as written. Zero means DefaultMaxCrawlDelay, a
+	// negative value no limit.
+	MaxCrawlDelay time.Duration
+
+	// MaxParseDuration aborts parsing with ErrParseDeadline once it has
+	// taken longer than this, bounding the time spent compiling wildcard
+	// rules of a hostile file. Zero means no limit.
+	MaxParseDuration time.Duration
+
+	// NormalizeBackslashes replaces "\" by "/" in rule paths, for files
+	// written as if URLs were Windows paths ("Disallow: \admin"). It has
+	// no effect in strict mode, which takes paths as written.
+	NormalizeBackslashes bool
+
+	// DecodePaths decodes the percent-encoding of rule paths, and of the
+	// paths tested against them, instead of normalizing it, so that "%2F"
+	// and "/" are the same. Tested paths may then be encoded or decoded,
+	// except that a decoded path containing "%" must be passed encoded,
+	// or its "%" is read as an escape.
+	DecodePaths bool
+
+	// SingleCharWildcard makes "?" in rule paths a wildcard matching exactly
+	// one character, as some nonstandard crawlers do. A "?" starting the
+	// query string, as in "/*?" or "/search?q=", is still literal.
+	SingleCharWildcard bool
+
+	// CompilePatterns sets Rule.Pattern, as earlier versions did, for rules
+	// with wildcards. Rules are matched without it, it only serves code
+	// reading the regexps. Rules using SingleCharWildcard always have one.
+	CompilePatterns bool
+
+	// PrefixAgentMatch selects groups the way earlier versions did, by the
+	// longest group agent that is a prefix of the whole agent passed to
+	// FindGroup, instead of by product token: "FooBot" then selects
+	// "User-agent: Foo".
+	PrefixAgentMatch bool
+
+	// MatchStrategy selects the precedence of matching rules, RFC 9309 by
+	// default.
+	MatchStrategy MatchStrategy
+
+	// IgnoreAllow drops Allow rules, reproducing crawlers that predate the
+	// Allow directive. The lines still belong to their group.
+	IgnoreAllow bool
+
+	// RejectHTML treats a body that looks like HTML, such as an error page
+	// or a <meta http-equiv="refresh"> redirect stub, as if there was no
+	// robots.txt: everything is allowed.
+	RejectHTML bool
+
+	// StripHTTPHeaders ignores an HTTP status line, and the headers and
+	// blank line following it, at the start of the body, as left by some
+	// proxies. It has no effect on strict parsing.
+	StripHTTPHeaders bool
+
+	// SplitDuplicateAgents stops merging the groups of an agent named by
+	// several groups, as RFC 9309 requires, for inspecting files as written.
+	// Groups then holds the first group of each agent, the rules of the
+	// following ones only apply to the other agents they name, and these
+	// groups are kept in RobotsData.DuplicateGroups.
+	SplitDuplicateAgents bool
+
+	// FirstGroupAsDefault makes FindGroup fall back to the first group of
+	// the file, instead of no group at all, for agents matching no group
+	// when there is no "*" group, as some crawlers do.
+	FirstGroupAsDefault bool
+
+	// PreserveOrder keeps every source line, including comments and blank
+	// lines, in RobotsData.Directives so that WriteDirectives can reproduce
+	// the file.
+	PreserveOrder bool
+
+	// StatusPolicy decides how the status codes of responses other than
+	// 2xx are interpreted.
+	StatusPolicy StatusPolicy
+}
+
+func (o *ParseOptions) logf(format string, v ...interface{}) {
+	if o.Logger != nil {
+		o.Logger.Printf(format, v...)
+	}
+}
+
+// repair reports whether likely mistakes are reinterpreted, see Repair.
+func (o *ParseOptions) repair() bool {
+	return o.Repair && !o.Strict
+}
+
+func (o *ParseOptions) maxGroups() int {
+	if o.MaxGroups <= 0 {
+		return DefaultMaxGroups
+	}
+	return o.MaxGroups
+}
+
+func (o *ParseOptions) maxWildcards() int {
+	if o.MaxWildcards <= 0 {
+		return DefaultMaxWildcards
+	}
+	return o.MaxWildcards
+}
+
+func (o *ParseOptions) maxParseBytes() int64 {
+	if o.MaxParseBytes == 0 {
+		return DefaultMaxParseBytes
+	}
+	return o.MaxParseBytes
+}
+
+func (o *ParseOptions) maxAgentLength() int {
+	if o.MaxAgentLength <= 0 {
+		return DefaultMaxAgentLength
+	}
+	return o.MaxAgentLength
+}
@@ -7,6 +7,7 @@ package robotstxt
 // http://en.wikipedia.org/wiki/Robots.txt
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"math"
@@ -14,6 +15,7 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 )
 
 type lineType uint
@@ -27,11 +29,54 @@ const (
 	lCrawlDelay
 	lSitemap
 	lHost
+	lRequestRate
+	lVisitTime
+	lNoindex
+	lCleanParam
+	lEmptyAgent // User-agent without value or too long, lenient parsing only
 )
 
+// groupMember reports whether lines of type t belong to a group.
+func groupMember(t lineType) bool {
+	switch t {
+	case lAllow, lDisallow, lCrawlDelay, lRequestRate, lVisitTime, lNoindex:
+		return true
+	}
+	return false
+}
+
 type parser struct {
 	tokens []string
+	lines  []int
 	pos    int
+	opts   *ParseOptions
+
+	groupsCapped bool // MaxGroups was reached
+	expired      bool // MaxParseDuration was exceeded
+
+	// With ParseOptions.SplitDuplicateAgents, the agents whose group has
+	// ended, the groups the current group adds for them, and all of these
+	// later groups in source order.
+	closed     map[string]bool
+	blockDups  map[string]*Group
+	duplicates []*Group
+
+	firstAgent string // Key of the first group created
+	created    int    // Number of groups created
+
+	// Group.Agents: the groups given the agents of the current group, these
+	// agents, and the number of agents read merging the lists of groups
+	// named again, bounded against files naming many agents in many groups.
+	joined       map[*Group]bool
+	blockAgents  []string
+	mergedAgents int
+	agentsCapped bool
+
+	lineStart    int       // Source line of the line being parsed
+	lineToken    int       // Position of its first token
+	warnings     []Warning // Lines skipped by lenient parsing
+	sitemapLines []int     // Source line of each sitemap
+	cleanParams  []CleanParam
 }
 
 type lineInfo struct {
@@ -40,79 +85,279 @@ type lineInfo struct {
 	vs string         // String value of the key
 	vf float64        // Float value of the key
 	vr *regexp.Regexp // Regexp value of the key
+	vw *wildcard      // Wildcard matcher value of the key
+	ln int            // Source line of the key
 }
 
-func newParser(tokens []string) *parser {
-	return &parser{tokens: tokens}
+var pathSpaceEncoder = strings.NewReplacer(" ", "%20", "\t", "%09")
+
+func newParser(tokens []string, lines []int, opts *ParseOptions) *parser {
+	return &parser{tokens: tokens, lines: lines, opts: opts}
 }
 
-func parseGroupMap(groups map[string]*Group, agents []string, fun func(*Group)) {
+// parseGroupMap applies fun to the groups of agents, creating missing groups.
+// Groups are keyed by lower case agent, the Agent of a new group keeps the
+// spelling it was first seen with.
+// If max is positive, no groups are created past max groups and the
+// number of agents left out is returned.
+func parseGroupMap(groups map[string]*Group, agents []string, max int, fun func(*Group)) (dropped int) {
 	var g *Group
 	for _, a := range agents {
-		if g = groups[a]; g == nil {
+		key := strings.ToLower(a)
+		if g = groups[key]; g == nil {
+			if max > 0 && len(groups) >= max {
+				dropped++
+				continue
+			}
 			g = new(Group)
 			g.Agent = a
-			groups[a] = g
+			groups[key] = g
 		}
 		fun(g)
 	}
+	return dropped
+}
+
+// updateGroups is parseGroupMap limited by ParseOptions.MaxGroups. With
+// ParseOptions.SplitDuplicateAgents, agents whose group has ended get a new
+// group instead.
+func (p *parser) updateGroups(groups map[string]*Group, agents []string, fun func(*Group)) {
+	update, block := fun, agents
+	fun = func(g *Group) {
+		if g.line == 0 {
+			p.created++
+			g.line, g.seq = p.lineStart, p.created
+		}
+		if !p.joined[g] {
+			p.joinAgents(g, block)
+		}
+		update(g)
+	}
+	if p.opts.SplitDuplicateAgents && len(p.closed) > 0 {
+		fresh := agents[:0:0]
+		for _, a := range agents {
+			key := strings.ToLower(a)
+			if !p.closed[key] {
+				fresh = append(fresh, a)
+				continue
+			}
+			g := p.blockDups[key]
+			if g == nil {
+				g = &Group{Agent: a}
+				p.blockDups[key] = g
+				p.duplicates = append(p.duplicates, g)
+			}
+			fun(g)
+		}
+		agents = fresh
+	}
+	max := p.opts.maxGroups()
+	if parseGroupMap(groups, agents, max, fun) > 0 && !p.groupsCapped {
+		p.groupsCapped = true
+		p.warn(WarnTooManyGroups, "more than %d groups, ignoring new user-agents from token #%d", max, p.pos)
+	}
+	if p.firstAgent == "" && len(agents) > 0 {
+		p.firstAgent = strings.ToLower(agents[0])
+	}
+}
+
+// joinAgents adds the agents of the current group, block, to the Agents of
+// g. Groups first seen in this group share one list.
+func (p *parser) joinAgents(g *Group, block []string) {
+	if p.joined == nil {
+		p.joined = make(map[*Group]bool)
+		p.blockAgents = appendAgents(nil, block, p.opts.maxGroups())
+	}
+	p.joined[g] = true
+	if len(g.Agents) == 0 {
+		// Full slice expression, appending must copy.
+		g.Agents = p.blockAgents[:len(p.blockAgents):len(p.blockAgents)]
+		return
+	}
+	if max := p.opts.maxGroups(); p.mergedAgents > 4*max {
+		if !p.agentsCapped {
+			p.agentsCapped = true
+			p.warn(WarnTooManyGroups, "more than %d agents in repeated groups, not listing the agents of groups from token #%d", 4*max, p.pos)
+		}
+		return
+	}
+	n := len(g.Agents)
+	g.Agents = appendAgents(g.Agents[:n:n], p.blockAgents, p.opts.maxGroups())
+	p.mergedAgents += n + len(p.blockAgents)
+}
+
+// appendAgents appends to names those of agents it does not hold yet,
+// ignoring case, up to max names.
+func appendAgents(names, agents []string, max int) []string {
+	seen := make(map[string]bool, len(names)+len(agents))
+	for _, n := range names {
+		seen[strings.ToLower(n)] = true
+	}
+	for _, a := range agents {
+		if key := strings.ToLower(a); !seen[key] && len(names) < max {
+			seen[key] = true
+			names = append(names, a)
+		}
+	}
+	return names
+}
+
+// Directive is one source line as written.
+type Directive struct {
+	Line    int
+	Key     string // Directive name, empty for blank, comment and junk lines
+	Value   string // Directive value, or the text of a junk line
+	Comment string // Trailing comment including "#", if any
+}
+
+func (d Directive) String() string {
+	s := d.Value
+	switch {
+	case d.Key != "" && d.Value == "":
+		s = d.Key + ":"
+	case d.Key != "":
+		s = d.Key + ": " + d.Value
+	}
+	if d.Comment != "" && s != "" {
+		s += " "
+	}
+	return s + d.Comment
+}
+
+// splitDirectives splits body into lines and those into directives.
+func splitDirectives(body []byte) []Directive {
+	body = bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))
+	lines := strings.Split(string(body), "\n")
+	ds := make([]Directive, len(lines))
+	for i, line := range lines {
+		d := Directive{Line: i + 1}
+		if j := strings.IndexByte(line, '#'); j >= 0 {
+			d.Comment = strings.TrimRightFunc(line[j:], unicode.IsSpace)
+			line = line[:j]
+		}
+		line = strings.TrimSpace(line)
+		if j := strings.IndexByte(line, ':'); j >= 0 {
+			d.Key = strings.TrimSpace(line[:j])
+			d.Value = strings.TrimSpace(line[j+1:])
+		} else {
+			d.Value = line
+		}
+		ds[i] = d
+	}
+	return ds
 }
 
 func (p *parser) parseAll() (groups map[string]*Group, host string, sitemaps []string, errs []error) {
 	groups = make(map[string]*Group, 16)
 	agents := make([]string, 0, 4)
 	isEmptyGroup := true
+	skipping := false // In the block of an empty User-agent
 
 	// Reset internal fields, tokens are assigned at creation time, never change
 	p.pos = 0
 
+	// Repairing applies group members found before any User-agent to all
+	// agents instead of rejecting them.
+	implicitGroup := func(li *lineInfo) {
+		if len(agents) == 0 && p.opts.repair() {
+			agents = append(agents, "*")
+			p.warn(WarnNoGroup, "%s before User-agent at token #%d, applying it to all agents", li.k, p.pos)
+		}
+	}
+
+	var deadline time.Time
+	if p.opts.MaxParseDuration > 0 {
+		deadline = time.Now().Add(p.opts.MaxParseDuration)
+	}
+
 	for {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			p.expired = true
+			break
+		}
+		p.lineStart, p.lineToken = p.line(), p.pos
 		if li, err := p.parseLine(); err != nil {
 			if err == io.EOF {
 				break
 			}
-			errs = append(errs, err)
+			errs = p.fail(errs, err)
 		} else {
+			if skipping && groupMember(li.t) {
+				continue
+			}
 			switch li.t {
+			case lEmptyAgent:
+				// An empty or too long User-agent sharing a block with
+				// other agents is ignored. One starting a block closes the current group,
+				// the members following it apply to no agent rather than
+				// to the previous group or, as an implicit group, to all.
+				if isEmptyGroup && len(agents) > 0 {
+					break
+				}
+				if p.opts.SplitDuplicateAgents && len(agents) > 0 {
+					p.closeGroup(agents)
+				}
+				agents = make([]string, 0, 4)
+				p.joined, p.blockAgents = nil, nil
+				isEmptyGroup, skipping = true, true
+
 			case lUserAgent:
+				skipping = false
 				// Two successive user-agent lines are part of the same group.
 				if !isEmptyGroup {
 					// End previous group
+					if p.opts.SplitDuplicateAgents {
+						p.closeGroup(agents)
+					}
 					agents = make([]string, 0, 4)
+					p.joined, p.blockAgents = nil, nil
 				}
 				if len(agents) == 0 {
 					isEmptyGroup = true
 				}
-				agents = append(agents, li.vs)
+				if strings.Contains(li.vs, ",") && p.opts.repair() {
+					// "User-agent: Googlebot, Bingbot" names two agents
+					for _, a := range strings.Split(li.vs, ",") {
+						if a = strings.TrimSpace(a); a != "" {
+							agents = append(agents, a)
+						}
+					}
+					p.warn(WarnRewritten, "comma-separated User-agent %q at token #%d, using each agent", li.vs, p.pos)
+				} else {
+					agents = append(agents, li.vs)
+				}
 
 			case lDisallow:
+				implicitGroup(li)
 				// Error if no current group
 				if len(agents) == 0 {
-					errs = append(errs, fmt.Errorf("Disallow before User-agent at token #%d.", p.pos))
+					errs = p.fail(errs, fmt.Errorf("Disallow before User-agent at token #%d.", p.pos))
 				} else {
 					isEmptyGroup = false
-					var r *Rule
-					if li.vr != nil {
-						r = &Rule{"", false, li.vr}
-					} else {
-						r = &Rule{li.vs, false, nil}
+					if li.vs == "" {
+						// From google's spec:
+						// When no Path is specified, the directive is ignored.
+						// The group still exists, with no restrictions.
+						p.updateGroups(groups, agents, func(*Group) {})
+						break
 					}
-					parseGroupMap(groups, agents, func(g *Group) { g.Rules = append(g.Rules, r) })
+					r := &Rule{Path: li.vs, Allow: false, Pattern: li.vr, Line: li.ln, wild: li.vw}
+					p.updateGroups(groups, agents, func(g *Group) { g.Rules = append(g.Rules, r) })
 				}
 
 			case lAllow:
+				implicitGroup(li)
 				// Error if no current group
 				if len(agents) == 0 {
-					errs = append(errs, fmt.Errorf("Allow before User-agent at token #%d.", p.pos))
+					errs = p.fail(errs, fmt.Errorf("Allow before User-agent at token #%d.", p.pos))
 				} else {
 					isEmptyGroup = false
-					var r *Rule
-					if li.vr != nil {
-						r = &Rule{"", true, li.vr}
-					} else {
-						r = &Rule{li.vs, true, nil}
+					if li.vs == "" || p.opts.IgnoreAllow {
+						p.updateGroups(groups, agents, func(*Group) {})
+						break
 					}
-					parseGroupMap(groups, agents, func(g *Group) { g.Rules = append(g.Rules, r) })
+					r := &Rule{Path: li.vs, Allow: true, Pattern: li.vr, Line: li.ln, wild: li.vw}
+					p.updateGroups(groups, agents, func(g *Group) { g.Rules = append(g.Rules, r) })
 				}
 
 			case lHost:
@@ -120,22 +365,89 @@ func (p *parser) parseAll() (groups map[string]*Group, host string, sitemaps []s
 
 			case lSitemap:
 				sitemaps = append(sitemaps, li.vs)
+				p.sitemapLines = append(p.sitemapLines, li.ln)
+
+			case lCleanParam:
+				// Not a group member, applies to the host as a whole
+				if cp, err := parseCleanParam(li.vs); err == nil {
+					p.cleanParams = append(p.cleanParams, cp)
+				} else {
+					p.warn(WarnIgnoredValue, "ignoring %v at token #%d", err, p.pos)
+				}
+
+			case lNoindex:
+				implicitGroup(li)
+				if len(agents) == 0 {
+					errs = p.fail(errs, fmt.Errorf("Noindex before User-agent at token #%d.", p.pos))
+					break
+				}
+				isEmptyGroup = false
+				if li.vs == "" {
+					p.updateGroups(groups, agents, func(*Group) {})
+					break
+				}
+				r := &Rule{Path: li.vs, Pattern: li.vr, Line: li.ln, wild: li.vw}
+				p.updateGroups(groups, agents, func(g *Group) { g.Noindex = append(g.Noindex, r) })
 
 			case lCrawlDelay:
+				implicitGroup(li)
 				if len(agents) == 0 {
-					errs = append(errs, fmt.Errorf("Crawl-delay before User-agent at token #%d.", p.pos))
+					errs = p.fail(errs, fmt.Errorf("Crawl-delay before User-agent at token #%d.", p.pos))
 				} else {
 					isEmptyGroup = false
-					delay := time.Duration(li.vf * float64(time.Second))
-					parseGroupMap(groups, agents, func(g *Group) { g.CrawlDelay = delay })
+					delay := time.Duration(math.MaxInt64)
+					if s := li.vf * float64(time.Second); s < float64(math.MaxInt64) {
+						delay = time.Duration(s)
+					}
+					p.updateGroups(groups, agents, func(g *Group) { g.CrawlDelay = delay })
 				}
+
+			case lRequestRate, lVisitTime:
+				implicitGroup(li)
+				if len(agents) == 0 {
+					errs = p.fail(errs, fmt.Errorf("%s before User-agent at token #%d.", li.k, p.pos))
+					break
+				}
+				// Nonstandard directives, malformed values are only logged
+				isEmptyGroup = false
+				var fun func(*Group)
+				if li.t == lRequestRate {
+					if rr, err := parseRequestRate(li.vs); err == nil {
+						fun = func(g *Group) { g.RequestRate = rr }
+					} else {
+						p.warn(WarnIgnoredValue, "ignoring %v at token #%d", err, p.pos)
+					}
+				} else {
+					if vt, err := parseVisitTime(li.vs); err == nil {
+						fun = func(g *Group) { g.VisitTime = vt }
+					} else {
+						p.warn(WarnIgnoredValue, "ignoring %v at token #%d", err, p.pos)
+					}
+				}
+				if fun == nil {
+					fun = func(*Group) {}
+				}
+				p.updateGroups(groups, agents, fun)
 			}
 		}
 	}
 	return
 }
 
+// closeGroup records that the group of agents has ended, so that later
+// groups naming them are kept apart.
+func (p *parser) closeGroup(agents []string) {
+	if p.closed == nil {
+		p.closed = make(map[string]bool)
+	}
+	for _, a := range agents {
+		p.closed[strings.ToLower(a)] = true
+	}
+	p.blockDups = make(map[string]*Group)
+}
+
 func (p *parser) parseLine() (li *lineInfo, err error) {
+	line := p.line()
 	t1, ok1 := p.popToken()
 	if !ok1 {
 		// proper EOF
@@ -145,6 +457,9 @@ func (p *parser) parseLine() (li *lineInfo, err error) {
 	t2, ok2 := p.peekToken()
 	if !ok2 {
 		// EOF, no value associated with the token, so ignore token and return
+		if t1 != tokEOL {
+			p.warn(WarnTruncated, "input truncated, ignoring %q at token #%d", t1, p.pos)
+		}
 		return nil, io.EOF
 	}
 
@@ -154,47 +469,56 @@ func (p *parser) parseLine() (li *lineInfo, err error) {
 	// - Otherwise return the specified line info
 	returnStringVal := func(t lineType) (*lineInfo, error) {
 		p.popToken()
-		if t2 != "" {
-			return &lineInfo{t: t, k: t1, vs: t2}, nil
+		if t2 != "" && t2 != tokEOL {
+			return &lineInfo{t: t, k: t1, vs: t2, ln: line}, nil
 		}
 		return &lineInfo{t: lIgnore}, nil
 	}
 
 	// Helper closure for all Path tokens (Allow/disallow), common behaviour:
 	// - Consume t2 token
-	// - If empty, return unknown line info
-	// - Otherwise, normalize the Path (add leading "/" if missing, remove trailing "*")
+	// - If empty, return line info without a Path, the line still belongs to
+	//   the group
+	// - Otherwise, normalize the Path (backslashes if enabled, add leading "/"
+	//   if missing, remove trailing "*")
+	// - Cut the Path at the first wildcard if it has more than MaxWildcards
 	// - Detect if wildcards are present, if so, compile into a regexp
 	// - Return the specified line info
 	returnPathVal := func(t lineType) (*lineInfo, error) {
 		p.popToken()
-		if t2 != "" {
+		if t2 != "" && t2 != tokEOL {
+			if p.opts.NormalizeBackslashes && !p.opts.Strict && strings.Contains(t2, `\`) {
+				t2 = strings.Replace(t2, `\`, "/", -1)
+				p.warn(WarnRewritten, "%s rule at token #%d uses backslashes, using %q", t1, p.pos, t2)
+			}
+			if strings.ContainsAny(t2, " \t") {
+				// URL paths cannot contain unencoded whitespace
+				if !p.opts.repair() {
+					return nil, fmt.Errorf("%s path '%s' contains whitespace at token #%d", t1, t2, p.pos)
+				}
+				t2 = pathSpaceEncoder.Replace(t2)
+				p.warn(WarnRewritten, "%s path at token #%d contains whitespace, using %q", t1, p.pos, t2)
+			}
 			if !strings.HasPrefix(t2, "*") && !strings.HasPrefix(t2, "/") {
 				t2 = "/" + t2
 			}
 			t2 = strings.TrimRightFunc(t2, isAsterisk)
-			// From google's spec:
-			// Google, Bing, Yahoo, and Ask support a limited form of
-			// "wildcards" for Path values. These are:
-			//   * designates 0 or more instances of any valid character
-			//   $ designates the end of the URL
-			if strings.ContainsAny(t2, "*$") {
-				// Must compile a regexp, this is a Pattern.
-				// Escape string before compile.
-				t2 = regexp.QuoteMeta(t2)
-				t2 = strings.Replace(t2, `\*`, `.*`, -1)
-				t2 = strings.Replace(t2, `\$`, `$`, -1)
-				if r, e := regexp.Compile(t2); e != nil {
-					return nil, e
-				} else {
-					return &lineInfo{t: t, k: t1, vr: r}, nil
+			if n, max := strings.Count(t2, "*"), p.opts.maxWildcards(); n > max {
+				// Keep the literal prefix rather than dropping the rule,
+				// "/" for a path starting with a wildcard
+				if t2 = t2[:strings.IndexByte(t2, '*')]; t2 == "" {
+					t2 = "/"
 				}
-			} else {
-				// Simple string Path
-				return &lineInfo{t: t, k: t1, vs: t2}, nil
+				p.warn(WarnRewritten, "%s rule at token #%d has %d wildcards, more than %d, using %q",
+					t1, p.pos, n, max, t2)
+			}
+			path, w, r, e := compilePath(t2, p.opts)
+			if e != nil {
+				return nil, e
 			}
+			return &lineInfo{t: t, k: t1, vs: path, vr: r, vw: w, ln: line}, nil
 		}
-		return &lineInfo{t: lIgnore}, nil
+		return &lineInfo{t: t, k: t1, ln: line}, nil
 	}
 
 	switch strings.ToLower(t1) {
@@ -207,8 +531,25 @@ func (p *parser) parseLine() (li *lineInfo, err error) {
 		// Handling of <field> elements with simple errors / typos (eg "useragent"
 		// instead of "user-agent") is undefined and may be interpreted as correct
 		// directives by some user-agents.
-		// The user-agent is non-case-sensitive.
-		//t2 = strings.ToLower(t2)
+		// The user-agent is non-case-sensitive: groups are keyed by lower
+		// case agent (see parseGroupMap).
+		if t2 == "" || t2 == tokEOL {
+			p.popToken()
+			if p.opts.Strict {
+				return nil, fmt.Errorf("User-agent without value at token #%d", p.pos)
+			}
+			p.warn(WarnEmptyValue, "ignoring User-agent without value at token #%d", p.pos)
+			return &lineInfo{t: lEmptyAgent}, nil
+		}
+		if max := p.opts.maxAgentLength(); len(t2) > max {
+			// A cut agent could match crawlers it was not written for
+			p.popToken()
+			if p.opts.Strict {
+				return nil, fmt.Errorf("User-agent at token #%d is %d bytes long, more than %d", p.pos, len(t2), max)
+			}
+			p.warn(WarnLongAgent, "ignoring User-agent at token #%d, %d bytes long, more than %d", p.pos, len(t2), max)
+			return &lineInfo{t: lEmptyAgent}, nil
+		}
 		return returnStringVal(lUserAgent)
 	case "disallow":
 		// From google's spec:
@@ -231,25 +572,113 @@ func (p *parser) parseLine() (li *lineInfo, err error) {
 		// Non-group field, applies to the host as a whole, not to a specific user-agent
 		return returnStringVal(lSitemap)
 
+	case "noindex":
+		// Nonstandard, pages not to index, once read by Google: "Noindex: /path"
+		return returnPathVal(lNoindex)
+
+	case "clean-param", "cleanparam":
+		// Nonstandard, URL parameters not changing the content of the pages:
+		// "Clean-param: ref&sid /path". Read more:
+		// https://yandex.com/support/webmaster/robot-workings/clean-param.html
+		return returnStringVal(lCleanParam)
+
+	case "request-rate", "requestrate":
+		// Nonstandard, at most n requests every d seconds: "Request-rate: n/d"
+		return returnStringVal(lRequestRate)
+
+	case "visit-time", "visittime":
+		// Nonstandard, time of day to visit in UTC: "Visit-time: 0600-0845"
+		return returnStringVal(lVisitTime)
+
 	case "crawl-delay", "crawldelay":
 		// From http://en.wikipedia.org/wiki/Robots_exclusion_standard#Nonstandard_extensions
 		// Several major crawlers support a Crawl-delay parameter, set to the
 		// number of seconds to wait between successive requests to the same server.
 		p.popToken()
-		if cd, e := strconv.ParseFloat(t2, 64); e != nil {
+		if cd, e := p.parseCrawlDelay(t2); e != nil {
 			return nil, e
-		} else if cd < 0 || math.IsInf(cd, 0) || math.IsNaN(cd) {
-			return nil, fmt.Errorf("Crawl-delay invalid value '%s'", t2)
 		} else {
-			return &lineInfo{t: lCrawlDelay, k: t1, vf: cd}, nil
+			return &lineInfo{t: lCrawlDelay, k: t1, vf: cd, ln: line}, nil
 		}
 	}
 
 	// Consume t2 token
 	p.popToken()
+	p.warn(WarnUnknownDirective, "ignoring unknown directive %q at token #%d", t1, p.pos)
 	return &lineInfo{t: lUnknown, k: t1}, nil
 }
 
+// parseCrawlDelay parses a Crawl-delay value in seconds.
+func (p *parser) parseCrawlDelay(v string) (float64, error) {
+	cd, err := strconv.ParseFloat(v, 64)
+	if err != nil && p.opts.repair() {
+		// "2rps" means two requests per second, that is 0.5s between them.
+		lower := strings.ToLower(v)
+		if strings.HasSuffix(lower, "rps") {
+			if rps, e := strconv.ParseFloat(strings.TrimSpace(v[:len(v)-3]), 64); e == nil && rps > 0 {
+				cd, err = 1/rps, nil
+				p.warn(WarnRewritten, "Crawl-delay '%s' at token #%d is a request rate, using %vs", v, p.pos, cd)
+			}
+		}
+	}
+	if err != nil && p.opts.repair() {
+		// Use the leading number of "5 seconds", "5 # five" and the like.
+		if fields := strings.Fields(v); len(fields) > 1 {
+			if n, e := strconv.ParseFloat(fields[0], 64); e == nil {
+				cd, err = n, nil
+				p.warn(WarnRewritten, "ignoring trailing '%s' after Crawl-delay at token #%d",
+					strings.TrimSpace(v[len(fields[0]):]), p.pos)
+				v = fields[0]
+			}
+		}
+	}
+	if err != nil && p.opts.repair() {
+		// A range like "1-5" is not valid, but its upper bound is the
+		// conservative reading of what the author meant.
+		if i := strings.IndexByte(v, '-'); i > 0 {
+			lo, e1 := strconv.ParseFloat(strings.TrimSpace(v[:i]), 64)
+			hi, e2 := strconv.ParseFloat(strings.TrimSpace(v[i+1:]), 64)
+			if e1 == nil && e2 == nil {
+				cd, err = math.Max(lo, hi), nil
+				p.warn(WarnRewritten, "Crawl-delay range '%s' at token #%d, using %v", v, p.pos, cd)
+			}
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	if cd < 0 || math.IsInf(cd, 0) || math.IsNaN(cd) {
+		return 0, fmt.Errorf("Crawl-delay invalid value '%s'", v)
+	}
+	return cd, nil
+}
+
+// fail handles a malformed line. Strict parsing collects err for the
+// caller, lenient parsing warns about it and skips the line.
+func (p *parser) fail(errs []error, err error) []error {
+	if p.opts.Strict {
+		return append(errs, err)
+	}
+	p.warn(WarnMalformed, "ignoring malformed line: %v", err)
+	return errs
+}
+
+// warn logs a problem with the line being parsed and records it.
+func (p *parser) warn(kind WarningKind, format string, v ...interface{}) {
+	msg := fmt.Sprintf(format, v...)
+	p.opts.logf("robotstxt: %s", msg)
+	p.warnings = append(p.warnings, Warning{Line: p.lineStart, Kind: kind, Text: p.lineText(), Message: msg})
+}
+
+// lineText returns the line being parsed as "key: value".
+func (p *parser) lineText() string {
+	var parts []string
+	for i := p.lineToken; i < len(p.tokens) && p.tokens[i] != tokEOL && len(parts) < 2; i++ {
+		parts = append(parts, p.tokens[i])
+	}
+	return strings.Join(parts, ": ")
+}
+
 func (p *parser) popToken() (tok string, ok bool) {
 	tok, ok = p.peekToken()
 	if !ok {
@@ -259,6 +688,14 @@ func (p *parser) popToken() (tok string, ok bool) {
 	return tok, true
 }
 
+// line returns the source line of the next token, zero if unknown.
+func (p *parser) line() int {
+	if p.pos >= len(p.lines) {
+		return 0
+	}
+	return p.lines[p.pos]
+}
+
 func (p *parser) peekToken() (tok string, ok bool) {
 	if p.pos >= len(p.tokens) {
 		return "", false
@@ -266,6 +703,87 @@ func (p *parser) peekToken() (tok string, ok bool) {
 	return p.tokens[p.pos], true
 }
 
+// compilePath removes trailing "*" from a rule path, normalizes or with
+// opts.DecodePaths decodes its percent-encoding, and builds the matcher of
+// the remaining wildcards, if any. Only a final "$" anchors the end of the
+// path, elsewhere it is literal. With opts.SingleCharWildcard, "?" before
+// the query string is a wildcard matching exactly one character, which
+// only a regexp can match. With opts.CompilePatterns, the regexp is built
+// for every path with wildcards.
+func compilePath(path string, opts *ParseOptions) (string, *wildcard, *regexp.Regexp, error) {
+	path = strings.TrimRightFunc(path, isAsterisk)
+	if opts.DecodePaths {
+		path = decodePath(path)
+	} else {
+		path = normalizeEscapes(path)
+	}
+	// "?" in path[:q] are wildcards
+	q := 0
+	if opts.SingleCharWildcard {
+		q = queryStart(path)
+	}
+	// From google's spec:
+	// Google, Bing, Yahoo, and Ask support a limited form of
+	// "wildcards" for Path values. These are:
+	//   * designates 0 or more instances of any valid character
+	//   $ designates the end of the URL
+	single := strings.Contains(path[:q], "?")
+	if !strings.Contains(path, "*") && !strings.HasSuffix(path, "$") && !single {
+		// Simple string Path
+		return path, nil, nil, nil
+	}
+	var w *wildcard
+	if !single {
+		w = newWildcard(path)
+		if !opts.CompilePatterns {
+			return path, w, nil, nil
+		}
+	}
+	r, err := regexp.Compile(patternExpr(path, q))
+	if err != nil {
+		return "", nil, nil, err
+	}
+	return path, w, r, nil
+}
+
+// patternExpr returns the regexp matching the rule path pattern, where "?"
+// in pattern[:q] are wildcards. The regexp is escaped and matches from the
+// start of the path like a simple string Path.
+func patternExpr(pattern string, q int) string {
+	end := ""
+	if strings.HasSuffix(pattern, "$") {
+		pattern, end = pattern[:len(pattern)-1], "$"
+	}
+	if q > len(pattern) {
+		q = len(pattern)
+	}
+	expr := "^" + strings.Replace(regexp.QuoteMeta(pattern[:q]), `\?`, `.`, -1) + regexp.QuoteMeta(pattern[q:])
+	return strings.Replace(expr, `\*`, `.*`, -1) + end
+}
+
+// queryStart returns the index of the "?" starting the query string of a
+// rule path, len(path) if there is none. A "?" is taken as the start of the
+// query when it ends the path or when the text up to the next "/" looks like
+// parameters ("?id=", "?a&b").
+func queryStart(path string) int {
+	for i, c := range path {
+		if c != '?' {
+			continue
+		}
+		rest := path[i+1:]
+		if rest == "" || rest == "$" {
+			return i
+		}
+		if j := strings.IndexByte(rest, '/'); j >= 0 {
+			rest = rest[:j]
+		}
+		if strings.ContainsAny(rest, "=&") {
+			return i
+		}
+	}
+	return len(path)
+}
+
 func isAsterisk(r rune) bool {
 	return r == '*'
 }
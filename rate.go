@@ -0,0 +1,133 @@
+package robotstxt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RequestRate is the value of the nonstandard Request-rate directive:
+// at most Requests requests every Per, as in "Request-rate: 1/5s".
+type RequestRate struct {
+	Requests int
+	Per      time.Duration
+}
+
+// Interval returns the time to wait between two requests.
+func (rr *RequestRate) Interval() time.Duration {
+	return rr.Per / time.Duration(rr.Requests)
+}
+
+func (rr *RequestRate) String() string {
+	return strconv.Itoa(rr.Requests) + "/" + strconv.FormatFloat(rr.Per.Seconds(), 'f', -1, 64) + "s"
+}
+
+// VisitTime is the value of the nonstandard Visit-time directive, the time
+// of day, in UTC, crawlers are asked to restrict their visits to, as in
+// "Visit-time: 0600-0845". From and To are offsets from midnight, a window
+// with To before From wraps around midnight.
+type VisitTime struct {
+	From, To time.Duration
+}
+
+// Contains reports whether t falls in the window.
+func (vt *VisitTime) Contains(t time.Time) bool {
+	t = t.UTC()
+	d := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second
+	if vt.From <= vt.To {
+		return d >= vt.From && d <= vt.To
+	}
+	return d >= vt.From || d <= vt.To
+}
+
+func (vt *VisitTime) String() string {
+	hm := func(d time.Duration) string {
+		return fmt.Sprintf("%02d%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+	}
+	return hm(vt.From) + "-" + hm(vt.To)
+}
+
+// CrawlBudget combines the signals of a group about how fast to crawl.
+type CrawlBudget struct {
+	// Interval is the minimum time between two requests, the longest of
+	// the Crawl-delay and of the interval given by the Request-rate.
+	Interval time.Duration
+
+	// VisitTime is the time of day to restrict visits to, nil if there is
+	// none.
+	VisitTime *VisitTime
+}
+
+// CrawlBudgetHint returns the crawl budget of the group applying to agent,
+// found by FindGroup. It is zero when nothing limits the crawl.
+func (r *RobotsData) CrawlBudgetHint(agent string) CrawlBudget {
+	if r.AllowAll || r.DisallowAll {
+		return CrawlBudget{}
+	}
+	g := r.FindGroup(agent)
+	b := CrawlBudget{Interval: g.CrawlDelay, VisitTime: g.VisitTime}
+	if g.RequestRate != nil {
+		if i := g.RequestRate.Interval(); i > b.Interval {
+			b.Interval = i
+		}
+	}
+	return b
+}
+
+// parseRequestRate parses a Request-rate value: a number of requests, "/"
+// and a number of seconds, optionally followed by the unit "s", "m" or "h".
+func parseRequestRate(v string) (*RequestRate, error) {
+	i := strings.IndexByte(v, '/')
+	if i < 0 {
+		return nil, fmt.Errorf("Request-rate invalid value '%s'", v)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(v[:i]))
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("Request-rate invalid value '%s'", v)
+	}
+	per, unit := strings.TrimSpace(v[i+1:]), time.Second
+	if per != "" {
+		switch per[len(per)-1] {
+		case 's', 'S':
+			per = per[:len(per)-1]
+		case 'm', 'M':
+			per, unit = per[:len(per)-1], time.Minute
+		case 'h', 'H':
+			per, unit = per[:len(per)-1], time.Hour
+		}
+	}
+	secs, err := strconv.ParseFloat(per, 64)
+	if err != nil || secs <= 0 || secs > float64(24*time.Hour/unit) {
+		return nil, fmt.Errorf("Request-rate invalid value '%s'", v)
+	}
+	return &RequestRate{Requests: n, Per: time.Duration(secs * float64(unit))}, nil
+}
+
+// parseVisitTime parses a Visit-time value: two times of day as "HHMM",
+// or "HH:MM", separated by "-".
+func parseVisitTime(v string) (*VisitTime, error) {
+	i := strings.IndexByte(v, '-')
+	if i < 0 {
+		return nil, fmt.Errorf("Visit-time invalid value '%s'", v)
+	}
+	from, ok1 := parseTimeOfDay(v[:i])
+	to, ok2 := parseTimeOfDay(v[i+1:])
+	if !ok1 || !ok2 {
+		return nil, fmt.Errorf("Visit-time invalid value '%s'", v)
+	}
+	return &VisitTime{From: from, To: to}, nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, bool) {
+	s = strings.Replace(strings.TrimSpace(s), ":", "", 1)
+	if len(s) != 4 {
+		return 0, false
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 || n/100 > 23 || n%100 > 59 {
+		return 0, false
+	}
+	return time.Duration(n/100)*time.Hour + time.Duration(n%100)*time.Minute, true
+}
@@ -9,14 +9,21 @@ package robotstxt
 import (
 	"bytes"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// RobotsData is a parsed robots.txt. Queries do not modify it, so it may be
+// shared by many goroutines as long as it is not modified meanwhile, by
+// AddRule or by changing its fields. See Compile.
 type RobotsData struct {
 	// public
 	Groups      map[string]*Group
@@ -24,24 +31,148 @@ type RobotsData struct {
 	DisallowAll bool
 	Host        string
 	Sitemaps    []string
+
+	// CleanParams holds the nonstandard Clean-param directives, in source
+	// order. Malformed ones are left out and listed in Warnings.
+	CleanParams []CleanParam
+
+	// RetryAfter is the delay given by the Retry-After header of a 429 or
+	// 503 response read by FromResponse, zero if there was none.
+	RetryAfter time.Duration
+
+	// Directives holds every line of the source in order, when parsed
+	// with ParseOptions.PreserveOrder.
+	Directives []Directive
+
+	// DuplicateGroups holds, in source order, the groups of agents already
+	// named by an earlier group, when parsed with
+	// ParseOptions.SplitDuplicateAgents. They are not used for matching.
+	DuplicateGroups []*Group
+
+	// Warnings lists, ordered by source line, the lines parsing skipped or
+	// reinterpreted, the same as told to ParseOptions.Logger, including
+	// HTTP header blocks, HTML bodies and Unicode whitespace, and the
+	// Sitemap values that are not absolute http or https URLs, which are
+	// kept in Sitemaps but left out by SitemapURLs.
+	Warnings []Warning
+
+	// agents are the keys of Groups but "*" and "", and the other Agents
+	// of the groups, longest first, built once by the parser so that
+	// FindGroup can stop at the first match. It is never modified, only
+	// replaced, and ignored when Groups has changed size since. Compile
+	// rebuilds it.
+	agents      []agentIndex
+	tokens      map[string]string // Key of the group of each product token
+	indexedSize int               // Size of Groups when agents was built
+	starAlias   string            // Key of the group listing "*" in its Agents, if any
+
+	// prefixAgents is ParseOptions.PrefixAgentMatch.
+	prefixAgents bool
+
+	// maxCrawlDelay is ParseOptions.MaxCrawlDelay.
+	maxCrawlDelay time.Duration
+
+	compiled bool // Compile was called
+
+	// defaultGroup is the group FindGroup falls back to instead of none,
+	// see ParseOptions.FirstGroupAsDefault. It is one of the values of
+	// Groups, copies of the data must point it at their copy.
+	defaultGroup *Group
 }
 
 type Group struct {
 	Rules      []*Rule
 	Agent      string
 	CrawlDelay time.Duration
+
+	// RequestRate and VisitTime are the nonstandard Request-rate and
+	// Visit-time directives of the group, nil if absent.
+	RequestRate *RequestRate
+	VisitTime   *VisitTime
+
+	// Noindex holds the nonstandard Noindex rules of the group, paths not
+	// to index, matched like Disallow rules. They do not affect crawling.
+	Noindex []*Rule
+
+	// Agents lists, in source order, the agents named by the User-agent
+	// lines of the groups this group was parsed from, Agent included. RFC
+	// 9309 makes them share the group: each has an entry in Groups with the
+	// same Rules. FindGroup selects a group for any of its Agents, so a
+	// group built by hand may be stored under one of them only.
+	Agents []string
+
+	index       *ruleIndex    // Built by Compile
+	decodePaths bool          // Parsed with ParseOptions.DecodePaths
+	strategy    MatchStrategy // Parsed with ParseOptions.MatchStrategy
+	line        int           // Source line of the first member, zero if not parsed
+	seq         int           // Creation order when parsed, zero if not parsed
 }
 
 type Rule struct {
-	Path    string
-	Allow   bool
+	Path  string
+	Allow bool
+
+	// Pattern is the regexp equivalent to a Path with wildcards, only set
+	// with ParseOptions.CompilePatterns or SingleCharWildcard. A Pattern
+	// set by hand is used to match when the rule has no other matcher.
 	Pattern *regexp.Regexp
+	Line    int // Source line, zero for rules not parsed from text
+
+	wild      *wildcard     // Matcher of a parsed Path with wildcards
+	strategy  MatchStrategy // Ranking of the rule, see weight
+	inherited bool          // Copied from the "*" group by EffectiveGroup
 }
 
 type ParseError struct {
 	Errs []error
 }
 
+// Warning is a problem with a line that did not fail parsing, see
+// RobotsData.Warnings.
+type Warning struct {
+	Line    int // Source line, zero if unknown
+	Kind    WarningKind
+	Text    string // The offending line, as "key: value"
+	Message string
+}
+
+// WarningKind classifies warnings. The values are stable, new kinds are
+// only ever added at the end.
+type WarningKind int
+
+const (
+	WarnMalformed        WarningKind = iota // Malformed line, skipped
+	WarnUnknownDirective                    // Unknown directive, ignored
+	WarnNoGroup                             // Group member before any User-agent, applied to all agents
+	WarnEmptyValue                          // User-agent without value, ignored
+	WarnRewritten                           // Value read the way its author most likely meant it
+	WarnIgnoredValue                        // Malformed value of a nonstandard directive, ignored
+	WarnTruncated                           // Directive cut by the end of input, or input past MaxParseBytes, ignored
+	WarnTooManyGroups                       // User-agent past ParseOptions.MaxGroups, ignored
+	WarnInvalidSitemap                      // Sitemap that is not an absolute http or https URL
+	WarnHTTPHeaders                         // HTTP header block starting the body, ignored
+	WarnHTML                                // Body looking like HTML, such as a meta refresh stub
+	WarnUnicodeSpace                        // Unicode whitespace, such as U+00A0, read as a space
+	WarnLongAgent                           // User-agent longer than ParseOptions.MaxAgentLength, ignored
+)
+
+var warningNames = [...]string{"malformed", "unknown-directive", "no-group", "empty-value", "rewritten",
+	"ignored-value", "truncated", "too-many-groups", "invalid-sitemap", "http-headers", "html", "unicode-space", "long-agent"}
+
+func (k WarningKind) String() string {
+	if k < 0 || int(k) >= len(warningNames) {
+		return "unknown"
+	}
+	return warningNames[k]
+}
+
+func (w Warning) String() string {
+	if w.Line == 0 {
+		return w.Message
+	}
+	return fmt.Sprintf("line %d: %s", w.Line, w.Message)
+}
+
 func newParseError(errs []error) *ParseError {
 	return &ParseError{errs}
 }
@@ -56,14 +187,38 @@ func (e ParseError) Error() string {
 	return b.String()
 }
 
-var allowAll = &RobotsData{AllowAll: true}
-var disallowAll = &RobotsData{DisallowAll: true}
+// newAllowAll and newDisallowAll return fresh values rather than shared
+// ones, RobotsData may be modified by the caller (see AddRule).
+func newAllowAll() *RobotsData    { return &RobotsData{AllowAll: true} }
+func newDisallowAll() *RobotsData { return &RobotsData{DisallowAll: true} }
+
 var emptyGroup = &Group{}
 
+var metaRefresh = regexp.MustCompile(`(?i)<meta[^>]+http-equiv\s*=\s*["']?refresh`)
+
 func FromStatusAndBytes(statusCode int, body []byte) (*RobotsData, error) {
+	return fromStatusAndBytes(statusCode, body, &ParseOptions{})
+}
+
+// FromStatusAndBytesWithOptions is FromStatusAndBytes with explicit parser
+// options, opts.StatusPolicy deciding what statuses other than 2xx mean.
+func FromStatusAndBytesWithOptions(statusCode int, body []byte, opts ParseOptions) (*RobotsData, error) {
+	return fromStatusAndBytes(statusCode, body, &opts)
+}
+
+func fromStatusAndBytes(statusCode int, body []byte, opts *ParseOptions) (*RobotsData, error) {
+	switch opts.StatusPolicy.action(statusCode) {
+	case StatusAllowAll:
+		return newAllowAll(), nil
+	case StatusDisallowAll:
+		return newDisallowAll(), nil
+	case StatusError:
+		return nil, errors.New("Unexpected status: " + strconv.Itoa(statusCode))
+	}
+
 	switch {
 	case statusCode >= 200 && statusCode < 300:
-		return FromBytes(body)
+		return fromBytes(body, opts)
 
 	// From https://developers.google.com/webmasters/control-crawl-index/docs/robots_txt
 	//
@@ -72,13 +227,13 @@ func FromStatusAndBytes(statusCode int, body []byte) (*RobotsData, error) {
 	// This is a "full Allow" for crawling. Note: this includes 401
 	// "Unauthorized" and 403 "Forbidden" HTTP result codes.
 	case statusCode >= 400 && statusCode < 500:
-		return allowAll, nil
+		return newAllowAll(), nil
 
 	// From Google's spec:
 	// Server errors (5xx) are seen as temporary errors that result in a "full
 	// disallow" of crawling.
 	case statusCode >= 500 && statusCode < 600:
-		return disallowAll, nil
+		return newDisallowAll(), nil
 	}
 
 	return nil, errors.New("Unexpected status: " + strconv.Itoa(statusCode))
@@ -88,64 +243,816 @@ func FromStatusAndString(statusCode int, body string) (*RobotsData, error) {
 	return FromStatusAndBytes(statusCode, []byte(body))
 }
 
+// FromResponse parses the robots.txt in res according to its status code.
+// Relative Sitemap URLs are resolved against the request URL.
 func FromResponse(res *http.Response) (*RobotsData, error) {
+	return FromResponseWithOptions(res, ParseOptions{})
+}
+
+// FromResponseWithOptions is FromResponse with explicit parser options.
+// If opts.Logger is set it is also told about redirects that led to res.
+func FromResponseWithOptions(res *http.Response, opts ParseOptions) (*RobotsData, error) {
 	if res == nil {
 		// Edge case, if res is nil, return nil data
 		return nil, nil
 	}
-	buf, e := ioutil.ReadAll(res.Body)
-	if e != nil {
-		return nil, e
+	if opts.Base == nil && res.Request != nil {
+		opts.Base = res.Request.URL
+	}
+	status := res.StatusCode
+	if req := res.Request; req != nil && req.Response != nil {
+		from, hops := req, 0
+		for from.Response != nil && from.Response.Request != nil {
+			from = from.Response.Request
+			hops++
+		}
+		opts.logf("robotstxt: redirected from %s to %s", from.URL, req.URL)
+		if limit := opts.StatusPolicy.MaxRedirects; limit > 0 && hops > limit {
+			opts.logf("robotstxt: more than %d redirects", limit)
+			status = http.StatusMultipleChoices
+		}
+	}
+	if status >= 200 && status < 300 {
+		return fromReader(res.Body, &opts)
 	}
-	return FromStatusAndBytes(res.StatusCode, buf)
+	// The body of other responses does not matter, do not read it
+	r, err := fromStatusAndBytes(status, nil, &opts)
+	if r != nil && (status == 429 || status == 503) {
+		r.RetryAfter = retryAfter(res.Header.Get("Retry-After"), time.Now())
+		r.maxCrawlDelay = opts.MaxCrawlDelay
+	}
+	return r, err
+}
+
+// retryAfter returns the delay of the Retry-After header value v, a number
+// of seconds or an HTTP date, zero if v is empty or invalid.
+func retryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// ErrBodyTooLarge is returned when a robots.txt is larger than the limit
+// set with FromReaderWithLimit or ParseOptions.MaxBytes.
+var ErrBodyTooLarge = errors.New("robotstxt: body exceeds the size limit")
+
+// FromReader parses the robots.txt read from r until EOF, or until
+// DefaultMaxParseBytes, the rest is ignored.
+//
+// The body is scanned as it is read, by chunks of whole lines, so that only
+// its tokens are kept in memory. Its first readChunk bytes are looked at
+// as a whole to recognize HTML or an HTTP header block. With
+// ParseOptions.PreserveOrder, which keeps every line, the body is read into
+// memory up to the limits before parsing.
+func FromReader(r io.Reader) (*RobotsData, error) {
+	return fromReader(r, &ParseOptions{})
+}
+
+// FromReaderWithOptions is FromReader with explicit parser options.
+func FromReaderWithOptions(r io.Reader, opts ParseOptions) (*RobotsData, error) {
+	return fromReader(r, &opts)
+}
+
+// FromReaderWithLimit is FromReader failing with ErrBodyTooLarge as soon as
+// more than maxBytes have been read, without reading the rest of r.
+func FromReaderWithLimit(r io.Reader, maxBytes int64) (*RobotsData, error) {
+	return fromReader(r, &ParseOptions{MaxBytes: maxBytes})
+}
+
+// readChunk is the size of the reads of fromReader, and of the start of the
+// body it checks as a whole.
+const readChunk = 32 << 10
+
+// fromReader parses the body of r up to the limits of opts, scanning it as
+// it is read unless opts.PreserveOrder needs all of it.
+func fromReader(r io.Reader, opts *ParseOptions) (*RobotsData, error) {
+	limit := opts.maxParseBytes()
+	if limit > 0 && opts.MaxBytes <= 0 {
+		// What follows the limit is ignored, do not read it, but read one
+		// byte more to tell whether there is more.
+		r = io.LimitReader(r, limit+1)
+	}
+	if opts.PreserveOrder {
+		body, err := readBody(r, opts.MaxBytes)
+		if err != nil {
+			return nil, err
+		}
+		return fromBytes(body, opts)
+	}
+	if opts.MaxBytes > 0 {
+		r = io.LimitReader(r, opts.MaxBytes+1)
+	}
+	tooLarge := func(read int64) bool { return opts.MaxBytes > 0 && read > opts.MaxBytes }
+
+	// A body fitting in the first chunk is parsed as a whole
+	pending := make([]byte, readChunk)
+	n, err := io.ReadFull(r, pending)
+	pending = pending[:n]
+	read := int64(n)
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		if tooLarge(read) {
+			return nil, ErrBodyTooLarge
+		}
+		return fromBytes(pending, opts)
+	case err != nil:
+		return nil, err
+	}
+
+	var warnings []Warning
+	pending, ignored := checkStart(pending, opts, func(w Warning) { warnings = append(warnings, w) })
+	sc := newScanner(opts)
+	var tokens []string
+	line := 1           // Line following those scanned
+	scanned := int64(0) // Bytes scanned
+	started := false
+	scan := func(seg []byte, end bool) {
+		line += lineEndings(seg)
+		scanned += int64(len(seg))
+		if ignored || len(seg) == 0 {
+			return
+		}
+		if started {
+			sc.feedMore(seg, end)
+		} else {
+			sc.feed(seg, end)
+			started = true
+		}
+		tokens = append(tokens, sc.scanAll()...)
+	}
+
+	var truncated *Warning
+	buf := make([]byte, readChunk)
+	for eof := false; ; {
+		if limit > 0 && scanned+int64(len(pending)) > limit {
+			// Cut after the last line ending within the limit
+			kept := pending[:limit-scanned]
+			scan(kept[:bytes.LastIndexAny(kept, "\r\n")+1], true)
+			truncated = &Warning{
+				Line:    line,
+				Kind:    WarnTruncated,
+				Message: fmt.Sprintf("robots.txt is larger than %d bytes, ignoring the rest", limit),
+			}
+			opts.logf("robotstxt: %s", truncated.Message)
+			if opts.MaxBytes > 0 {
+				// The rest is not parsed but must be within MaxBytes
+				n, err := io.Copy(ioutil.Discard, r)
+				if err != nil {
+					return nil, err
+				}
+				if tooLarge(read + n) {
+					return nil, ErrBodyTooLarge
+				}
+			}
+			break
+		}
+		if eof {
+			scan(pending, true)
+			break
+		}
+		if i := bytes.LastIndexByte(pending, '\n') + 1; i > 0 {
+			scan(pending[:i], false)
+			pending = append(pending[:0], pending[i:]...)
+		}
+		n, err := r.Read(buf)
+		read += int64(n)
+		if tooLarge(read) {
+			return nil, ErrBodyTooLarge
+		}
+		pending = append(pending, buf[:n]...)
+		if err == io.EOF {
+			eof = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	var rd *RobotsData
+	if ignored {
+		rd = newAllowAll()
+		rd.Warnings = warnings
+	} else if rd, err = parseTokens(tokens, sc, warnings, nil, opts); err != nil {
+		return nil, err
+	}
+	if truncated != nil {
+		rd.Warnings = append(rd.Warnings, *truncated)
+	}
+	return rd, nil
+}
+
+// lineEndings counts the line endings of b: "\n", "\r\n" or "\r".
+func lineEndings(b []byte) int {
+	return bytes.Count(b, []byte("\n")) + bytes.Count(b, []byte("\r")) - bytes.Count(b, []byte("\r\n"))
+}
+
+// readBody reads r until EOF, or fails with ErrBodyTooLarge once more than
+// max bytes have been read if max is positive.
+func readBody(r io.Reader, max int64) ([]byte, error) {
+	if max <= 0 {
+		return ioutil.ReadAll(r)
+	}
+	// Read one byte more than allowed to tell a body of exactly max bytes
+	// from a larger one.
+	buf, err := ioutil.ReadAll(io.LimitReader(r, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(buf)) > max {
+		return nil, ErrBodyTooLarge
+	}
+	return buf, nil
 }
 
 func FromBytes(body []byte) (r *RobotsData, err error) {
-	var errs []error
+	return fromBytes(body, &ParseOptions{})
+}
 
+// FromBytesBase is FromBytes resolving relative Sitemap URLs against base,
+// normally the URL robots.txt was fetched from.
+func FromBytesBase(body []byte, base *url.URL) (*RobotsData, error) {
+	return fromBytes(body, &ParseOptions{Base: base})
+}
+
+// FromBytesWithOptions is FromBytes with explicit parser options.
+func FromBytesWithOptions(body []byte, opts ParseOptions) (*RobotsData, error) {
+	return fromBytes(body, &opts)
+}
+
+func fromBytes(body []byte, opts *ParseOptions) (*RobotsData, error) {
+	limit := opts.maxParseBytes()
+	if limit <= 0 || int64(len(body)) <= limit {
+		return parseBody(body, opts)
+	}
+	// Cut after the last line ending within the limit
+	n := bytes.LastIndexAny(body[:limit], "\r\n") + 1
+	w := Warning{
+		Line:    lineEndings(body[:n]) + 1,
+		Kind:    WarnTruncated,
+		Message: fmt.Sprintf("robots.txt is larger than %d bytes, ignoring the rest", limit),
+	}
+	opts.logf("robotstxt: %s", w.Message)
+	r, err := parseBody(body[:n], opts)
+	if err == nil {
+		r.Warnings = append(r.Warnings, w)
+	}
+	return r, err
+}
+
+func parseBody(body []byte, opts *ParseOptions) (*RobotsData, error) {
+	var warnings []Warning
+	body, ignored := checkStart(body, opts, func(w Warning) { warnings = append(warnings, w) })
 	// special case (probably not worth optimization?)
-	trimmed := bytes.TrimSpace(body)
-	if len(trimmed) == 0 {
-		return allowAll, nil
+	if ignored || len(bytes.TrimSpace(body)) == 0 {
+		r := newAllowAll()
+		r.Warnings = warnings
+		return r, nil
 	}
 
-	sc := newByteScanner("bytes", true)
-	//sc.Quiet = !print_errors
+	sc := newScanner(opts)
 	sc.feed(body, true)
-	tokens := sc.scanAll()
+	return parseTokens(sc.scanAll(), sc, warnings, body, opts)
+}
+
+// checkStart looks at head, the start of a body, for the HTTP header block
+// removed with ParseOptions.StripHTTPHeaders and for HTML, and calls warn
+// about them. It returns head with the header block blanked out, and
+// whether the body is to be ignored because of ParseOptions.RejectHTML.
+func checkStart(head []byte, opts *ParseOptions, warn func(Warning)) ([]byte, bool) {
+	add := func(line int, kind WarningKind, msg string) {
+		opts.logf("robotstxt: %s", msg)
+		warn(Warning{Line: line, Kind: kind, Message: msg})
+	}
+	if opts.StripHTTPHeaders && !opts.Strict {
+		if n := httpHeaderLen(head); n > 0 {
+			add(1, WarnHTTPHeaders, "body starts with an HTTP header block, ignoring it")
+			head = blankOut(head, n)
+		}
+	}
+	trimmed := bytes.TrimSpace(head)
+	if len(trimmed) == 0 || trimmed[0] != '<' {
+		return head, false
+	}
+	line := bytes.Count(head[:len(head)-len(bytes.TrimLeft(head, " \t\r\n\v\f"))], []byte("\n")) + 1
+	if metaRefresh.Match(trimmed) {
+		// A misconfigured redirect served with status 200
+		add(line, WarnHTML, "body is an HTML meta refresh stub, not robots.txt")
+	} else {
+		add(line, WarnHTML, "body looks like HTML, not robots.txt")
+	}
+	return head, opts.RejectHTML
+}
+
+// newScanner returns a scanner set up for opts.
+func newScanner(opts *ParseOptions) *byteScanner {
+	sc := newByteScanner("bytes", true)
+	sc.logger = opts.Logger
+	sc.unicodeSpace = opts.repair()
+	return sc
+}
+
+// parseTokens parses the tokens scanned by sc following warnings. body is
+// the whole input, only needed for ParseOptions.PreserveOrder.
+func parseTokens(tokens []string, sc *byteScanner, warnings []Warning, body []byte, opts *ParseOptions) (r *RobotsData, err error) {
+	var errs []error
+	warnings = append(warnings, sc.warnings...)
 
 	// special case worth optimization
 	if len(tokens) == 0 {
-		return allowAll, nil
+		r = newAllowAll()
+		r.Warnings = warnings
+		return r, nil
 	}
 
 	r = &RobotsData{}
-	parser := newParser(tokens)
+	parser := newParser(tokens, sc.lines, opts)
 	r.Groups, r.Host, r.Sitemaps, errs = parser.parseAll()
+	r.DuplicateGroups = parser.duplicates
+	r.prefixAgents = opts.PrefixAgentMatch
+	r.maxCrawlDelay = opts.MaxCrawlDelay
+	r.CleanParams = parser.cleanParams
+	r.Warnings = append(warnings, parser.warnings...)
+	if opts.FirstGroupAsDefault && r.Groups["*"] == nil {
+		r.defaultGroup = r.Groups[parser.firstAgent]
+	}
+	if parser.expired {
+		return nil, ErrParseDeadline
+	}
 	if len(errs) > 0 {
 		return nil, newParseError(errs)
 	}
+	r.indexAgents()
+	if opts.DecodePaths || opts.MatchStrategy != MatchRFC9309 {
+		for _, g := range r.Groups {
+			g.setOptions(opts)
+		}
+		for _, g := range r.DuplicateGroups {
+			g.setOptions(opts)
+		}
+	}
+	if opts.Base != nil {
+		resolveSitemaps(r.Sitemaps, opts.Base)
+	}
+	r.Warnings = append(r.Warnings, sitemapWarnings(r.Sitemaps, parser.sitemapLines)...)
+	sort.SliceStable(r.Warnings, func(i, j int) bool { return r.Warnings[i].Line < r.Warnings[j].Line })
+	if opts.PreserveOrder {
+		r.Directives = splitDirectives(body)
+	}
 
 	return r, nil
 }
 
+var (
+	httpStatusLine = regexp.MustCompile(`^HTTP/\d(\.\d)? \d{3}\b`)
+	httpHeaderLine = regexp.MustCompile(`^[!#$%&'*+.^_|~0-9A-Za-z-]+:`)
+)
+
+// httpHeaderLen returns the length of the HTTP status line and headers, up
+// to and including the blank line ending them, that some proxies prepend to
+// the body. If the headers are not followed by a blank line only the status
+// line is counted, the lines after it may well be robots.txt records.
+func httpHeaderLen(body []byte) int {
+	if !httpStatusLine.Match(body) {
+		return 0
+	}
+	status := bytes.IndexByte(body, '\n') + 1
+	if status == 0 {
+		return len(body)
+	}
+	for n := status; n < len(body); {
+		end := bytes.IndexByte(body[n:], '\n') + 1
+		if end == 0 {
+			break
+		}
+		line := bytes.TrimRight(body[n:n+end], "\r\n")
+		n += end
+		if len(line) == 0 {
+			return n
+		}
+		if !httpHeaderLine.Match(line) {
+			break
+		}
+	}
+	return status
+}
+
+// blankOut returns a copy of body with everything but line breaks in its
+// first n bytes replaced by spaces, keeping line numbers intact.
+func blankOut(body []byte, n int) []byte {
+	b := make([]byte, len(body))
+	copy(b, body)
+	for i := 0; i < n; i++ {
+		if b[i] != '\n' {
+			b[i] = ' '
+		}
+	}
+	return b
+}
+
 func FromString(body string) (r *RobotsData, err error) {
 	return FromBytes([]byte(body))
 }
 
 func (r *RobotsData) TestAgent(path, agent string) bool {
+	allowed, _, _ := r.TestAgentExplain(path, agent)
+	return allowed
+}
+
+// TestURL is TestAgent for the path and query of u. An empty path is "/".
+// u may use any equivalent percent-encoding of the URL: as RFC 9309 asks,
+// escapes of unreserved characters such as "%7E" match the character, and
+// hex digits are case insensitive, but "%2F" does not match "/".
+func (r *RobotsData) TestURL(u *url.URL, agent string) bool {
+	return r.TestAgent(requestPath(u), agent)
+}
+
+// TestURLString is TestURL for rawurl, it fails if rawurl cannot be parsed.
+func (r *RobotsData) TestURLString(rawurl, agent string) (bool, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false, err
+	}
+	return r.TestURL(u, agent), nil
+}
+
+// TestAgentURL is TestURL.
+func (r *RobotsData) TestAgentURL(u *url.URL, agent string) bool {
+	return r.TestURL(u, agent)
+}
+
+// TestAgentDefault is TestAgent returning def instead of true when no rule
+// matches path. AllowAll and DisallowAll data still allow and disallow
+// everything.
+func (r *RobotsData) TestAgentDefault(path, agent string, def bool) bool {
 	if r.AllowAll {
 		return true
 	}
 	if r.DisallowAll {
 		return false
 	}
+	if rule := r.FindGroup(agent).findRule(path); rule != nil {
+		return rule.Allow
+	}
+	return def
+}
 
-	// Find a group of Rules that applies to this agent
-	// From Google's spec:
-	// The user-agent is non-case-sensitive.
+// AddRule adds an Allow or Disallow rule for agent after parsing, creating
+// the agent's group if needed. path must start with "/" and may contain
+// wildcards. AddRule must not be called concurrently with queries, nor on
+// compiled data.
+func (r *RobotsData) AddRule(agent, path string, allow bool) error {
+	if r.compiled {
+		return ErrCompiled
+	}
+	if !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("robotstxt: rule path %q must start with \"/\"", path)
+	}
+	opts := &ParseOptions{DecodePaths: r.decodePaths(), MatchStrategy: r.matchStrategy()}
+	path, wild, pattern, err := compilePath(path, opts)
+	if err != nil {
+		return err
+	}
+
+	// The flags short-circuit all rules, replace them by equivalent groups.
+	if r.DisallowAll {
+		r.Groups = map[string]*Group{"*": {Agent: "*", Agents: []string{"*"}, Rules: []*Rule{{Path: "/"}}}}
+	}
+	r.AllowAll, r.DisallowAll = false, false
+	if r.Groups == nil {
+		r.Groups = make(map[string]*Group)
+	}
+
+	rule := &Rule{Path: path, Allow: allow, Pattern: pattern, wild: wild, strategy: opts.MatchStrategy}
+	parseGroupMap(r.Groups, []string{agent}, 0, func(g *Group) {
+		if len(g.Agents) == 0 {
+			g.Agents = []string{g.Agent}
+		}
+		g.Rules = append(g.Rules, rule)
+		g.decodePaths, g.strategy = opts.DecodePaths, opts.MatchStrategy
+	})
+	if r.agents != nil {
+		// agent may be new
+		r.indexAgents()
+	}
+	return nil
+}
+
+// TestExact is TestAgent that also reports whether the decision was
+// determined by a matching rule (or by DisallowAll). determined is false
+// when nothing matched and the default allow applied.
+func (r *RobotsData) TestExact(path, agent string) (allowed bool, determined bool) {
+	if r.AllowAll {
+		return true, false
+	}
+	if r.DisallowAll {
+		return false, true
+	}
+	if rule := r.FindGroup(agent).findRule(path); rule != nil {
+		return rule.Allow, true
+	}
+	return true, false
+}
+
+// SitemapCount returns the number of Sitemap directives.
+func (r *RobotsData) SitemapCount() int {
+	return len(r.Sitemaps)
+}
+
+// HasSitemaps reports whether any Sitemap directive was found.
+func (r *RobotsData) HasSitemaps() bool {
+	return len(r.Sitemaps) > 0
+}
+
+// MostSpecificRule returns the rule deciding path for agent, nil if no rule
+// matches. tied reports whether another rule matched equally specifically,
+// in which case an Allow rule, or else the rule listed first, was chosen.
+// With MatchLegacy, the rule listed first is always chosen.
+func (r *RobotsData) MostSpecificRule(path, agent string) (rule *Rule, tied bool) {
+	if r.AllowAll || r.DisallowAll {
+		return nil, false
+	}
 	g := r.FindGroup(agent)
-	return g.Test(path)
+	if rule = g.findRule(path); rule == nil {
+		return nil, false
+	}
+	path = g.subject(path)
+	l := rule.specificity(path)
+	for _, other := range g.Rules {
+		if other != rule && other.specificity(path) == l {
+			return rule, true
+		}
+	}
+	return rule, false
+}
+
+// TestWithTieBreaker is TestAgent choosing the outcome when an Allow and a
+// Disallow rule match path equally specifically: allowWins selects the
+// Allow rule, like TestAgent does, otherwise the Disallow rule wins.
+func (r *RobotsData) TestWithTieBreaker(path, agent string, allowWins bool) bool {
+	if r.AllowAll {
+		return true
+	}
+	if r.DisallowAll {
+		return false
+	}
+	tie := tieDisallow
+	if allowWins {
+		tie = tieAllow
+	}
+	if rule := r.FindGroup(agent).findRuleTie(path, tie); rule != nil {
+		return rule.Allow
+	}
+	return true
+}
+
+// Subset returns a new RobotsData holding only the group that applies to
+// agent, renamed to "*", along with Host and Sitemaps. It gives agent the
+// same answers as r.
+func (r *RobotsData) Subset(agent string) *RobotsData {
+	sub := &RobotsData{
+		AllowAll:    r.AllowAll,
+		DisallowAll: r.DisallowAll,
+		Host:        r.Host,
+		Sitemaps:    append([]string(nil), r.Sitemaps...),
+		CleanParams: append([]CleanParam(nil), r.CleanParams...),
+		RetryAfter:  r.RetryAfter,
+
+		prefixAgents:  r.prefixAgents,
+		maxCrawlDelay: r.maxCrawlDelay,
+	}
+	if r.AllowAll || r.DisallowAll {
+		return sub
+	}
+	sub.Groups = make(map[string]*Group, 1)
+	if g := r.FindGroup(agent); g != emptyGroup {
+		sub.Groups["*"] = &Group{
+			Agent:       "*",
+			Agents:      []string{"*"},
+			Rules:       append([]*Rule(nil), g.Rules...),
+			CrawlDelay:  g.CrawlDelay,
+			RequestRate: g.RequestRate,
+			VisitTime:   g.VisitTime,
+			Noindex:     append([]*Rule(nil), g.Noindex...),
+
+			decodePaths: g.decodePaths,
+			strategy:    g.strategy,
+		}
+	}
+	return sub
+}
+
+// CrawlDelay returns the crawl delay of the group that applies to agent, as
+// found by FindGroup, or else RetryAfter, and whether there was one. The
+// delay of the "*" group does not apply to agents that have a group of their
+// own, even one without a Crawl-delay. The delay is at most
+// ParseOptions.MaxCrawlDelay.
+func (r *RobotsData) CrawlDelay(agent string) (time.Duration, bool) {
+	var d time.Duration
+	if !r.AllowAll && !r.DisallowAll {
+		d = r.FindGroup(agent).CrawlDelay
+	}
+	if d <= 0 {
+		d = r.RetryAfter
+	}
+	if d <= 0 {
+		return 0, false
+	}
+	max := r.maxCrawlDelay
+	if max == 0 {
+		max = DefaultMaxCrawlDelay
+	}
+	if max > 0 && d > max {
+		d = max
+	}
+	return d, true
+}
+
+// WithDefaultCrawlDelay returns a copy of r in which the groups without a
+// Crawl-delay have a delay of d. r is not modified. AllowAll and DisallowAll
+// data have no groups to apply d to.
+func (r *RobotsData) WithDefaultCrawlDelay(d time.Duration) *RobotsData {
+	c := *r
+	c.Groups = make(map[string]*Group, len(r.Groups))
+	// Groups shared by several keys stay shared
+	copies := make(map[*Group]*Group, len(r.Groups))
+	for a, g := range r.Groups {
+		cg := copies[g]
+		if cg == nil {
+			cg = new(Group)
+			*cg = *g
+			cg.Rules = append([]*Rule(nil), g.Rules...)
+			if cg.CrawlDelay <= 0 {
+				cg.CrawlDelay = d
+			}
+			copies[g] = cg
+		}
+		c.Groups[a] = cg
+	}
+	if r.defaultGroup != nil {
+		c.defaultGroup = copies[r.defaultGroup]
+	}
+	return &c
+}
+
+// CrawlDelayOr returns the crawl delay for agent as CrawlDelay does, or def
+// if there is none.
+func (r *RobotsData) CrawlDelayOr(agent string, def time.Duration) time.Duration {
+	if d, ok := r.CrawlDelay(agent); ok {
+		return d
+	}
+	return def
+}
+
+// PreferredHost returns the host named by the Host directive, the main
+// mirror of the site, in lower case and without scheme or path. A port is
+// kept, it may distinguish mirrors: "Host: https://Example.com:8080/" gives
+// "example.com:8080". It is empty when there is no Host directive.
+func (r *RobotsData) PreferredHost() string {
+	return normalizeHost(r.Host)
+}
+
+// HostMismatch reports whether rawurl is on a different host than the one
+// named by the Host directive. It is false when there is no Host directive,
+// and true when rawurl cannot be parsed. Ports are only compared when the
+// Host directive names one.
+func (r *RobotsData) HostMismatch(rawurl string) bool {
+	if r.Host == "" {
+		return false
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Host == "" {
+		return true
+	}
+	want := r.PreferredHost()
+	if strings.Contains(want, ":") && !strings.HasSuffix(want, "]") {
+		return !strings.EqualFold(u.Host, want)
+	}
+	return !strings.EqualFold(u.Hostname(), strings.Trim(want, "[]"))
+}
+
+// ErrParseDeadline is returned when parsing takes longer than
+// ParseOptions.MaxParseDuration.
+var ErrParseDeadline = errors.New("robotstxt: parsing exceeded MaxParseDuration")
+
+// ErrOtherOrigin is returned by TestWithRedirectChain for a URL that the
+// robots.txt does not govern.
+var ErrOtherOrigin = errors.New("robotstxt: URL is not on the origin robots.txt was fetched from")
+
+// TestWithRedirectChain tests rawurl for agent against r, which was fetched
+// from fetchedURL, the final URL after following redirects. A robots.txt only
+// governs its own origin (scheme, host and port), so if rawurl is on another
+// origin the result is false with ErrOtherOrigin: the robots.txt of that
+// origin must be used instead, even if the original request was sent there.
+func (r *RobotsData) TestWithRedirectChain(rawurl, fetchedURL, agent string) (bool, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return false, err
+	}
+	from, err := url.Parse(fetchedURL)
+	if err != nil {
+		return false, err
+	}
+	if !sameOrigin(u, from) {
+		return false, ErrOtherOrigin
+	}
+	return r.TestAgent(requestPath(u), agent), nil
+}
+
+// sameOrigin reports whether a and b have the same scheme, host and port,
+// the port defaulting to the one of the scheme.
+func sameOrigin(a, b *url.URL) bool {
+	port := func(u *url.URL) string {
+		if p := u.Port(); p != "" {
+			return p
+		}
+		switch strings.ToLower(u.Scheme) {
+		case "http":
+			return "80"
+		case "https":
+			return "443"
+		}
+		return ""
+	}
+	return strings.EqualFold(a.Scheme, b.Scheme) &&
+		strings.EqualFold(a.Hostname(), b.Hostname()) &&
+		port(a) == port(b)
+}
+
+// normalizeHost reduces a Host directive value such as "https://Example.com/"
+// to its lower case host and optional port.
+func normalizeHost(host string) string {
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	if i := strings.IndexByte(host, '/'); i >= 0 {
+		host = host[:i]
+	}
+	return strings.ToLower(host)
+}
+
+// requestPath returns the part of u matched against rules: the escaped
+// path, "/" if empty, followed by the query if any.
+func requestPath(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return path
+}
+
+// EffectiveGroup returns the group applying to agent, like FindGroup. Per
+// spec a specific group does not inherit the rules of the "*" group, but
+// some crawlers merge them: with mergeWildcard a new group is returned that
+// holds the rules of both, the specific ones first, followed by copies of
+// the "*" ones. A rule of the specific group wins ties against the "*"
+// rules whatever their kind, so a "*" Allow does not override an equally
+// specific Disallow of the agent.
+func (r *RobotsData) EffectiveGroup(agent string, mergeWildcard bool) *Group {
+	g := r.FindGroup(agent)
+	star := r.Groups["*"]
+	if !mergeWildcard || star == nil || g == star || g == emptyGroup {
+		return g
+	}
+	merged := &Group{
+		Agent:       g.Agent,
+		Agents:      g.Agents,
+		Rules:       make([]*Rule, 0, len(g.Rules)+len(star.Rules)),
+		CrawlDelay:  g.CrawlDelay,
+		RequestRate: g.RequestRate,
+		VisitTime:   g.VisitTime,
+
+		decodePaths: g.decodePaths,
+		strategy:    g.strategy,
+	}
+	merged.Rules = append(merged.Rules, g.Rules...)
+	for _, rule := range star.Rules {
+		c := *rule
+		c.inherited = true
+		merged.Rules = append(merged.Rules, &c)
+	}
+	if merged.CrawlDelay == 0 {
+		merged.CrawlDelay = star.CrawlDelay
+	}
+	if merged.RequestRate == nil {
+		merged.RequestRate = star.RequestRate
+	}
+	if merged.VisitTime == nil {
+		merged.VisitTime = star.VisitTime
+	}
+	merged.Noindex = append(append(merged.Noindex, g.Noindex...), star.Noindex...)
+	return merged
 }
 
 // FindGroup searches block of declarations for specified user-agent.
@@ -155,29 +1062,204 @@ func (r *RobotsData) TestAgent(path, agent string) bool {
 // with the most specific user-agent that still matches. All other Groups of
 // records are ignored by the crawler. The user-agent is non-case-sensitive.
 // The order of the Groups within the robots.txt file is irrelevant.
+//
+// As RFC 9309 requires, a group applies to agent when its User-agent has
+// the same product token as agent, ignoring case: "Googlebot/2.1" selects
+// "User-agent: googlebot" but not "User-agent: Google". A group whose
+// User-agent is exactly the product token wins over others with the same
+// token, as "googlebot" over "googlebot/2.1". See productToken and
+// ParseOptions.PrefixAgentMatch.
+//
+// Groups are found through an index built by the parser, AddRule and
+// Compile. The index notices groups added to or removed from Groups
+// directly, but not a key replaced by another one, which keeps the size of
+// Groups: call Compile after changing the keys of Groups.
 func (r *RobotsData) FindGroup(agent string) (ret *Group) {
-	var prefixLen int
+	// Groups keys are lower case
+	agent = strings.ToLower(agent)
+	ret, ok := r.findGroupIndexed(agent)
+	if !ok {
+		ret = r.findGroupScan(agent)
+	}
 
-	//agent = strings.ToLower(agent)
-	if ret = r.Groups["*"]; ret != nil {
-		// Weakest match possible
-		prefixLen = 1
+	if ret == nil {
+		ret = r.defaultGroup
 	}
-	for a, g := range r.Groups {
-		if a != "*" && strings.HasPrefix(agent, a) {
-			if l := len(a); l > prefixLen {
-				prefixLen = l
-				ret = g
+	if ret == nil {
+		return emptyGroup
+	}
+	return
+}
+
+// findGroupIndexed is FindGroup using the index, agent is lower case. It
+// returns false if the index cannot be used, because Groups was modified
+// since it was built: a key listed by the index may have been replaced by
+// another one without changing the size of Groups.
+func (r *RobotsData) findGroupIndexed(agent string) (*Group, bool) {
+	if !r.indexed() {
+		return nil, false
+	}
+	key, found := "", false
+	if r.prefixAgents {
+		// The first match is the longest one
+		for _, a := range r.agents {
+			if strings.HasPrefix(agent, a.name) {
+				key, found = a.key, true
+				break
 			}
 		}
+	} else {
+		key, found = r.tokens[productToken(agent)]
+	}
+	if !found {
+		if g := r.Groups["*"]; g != nil || r.starAlias == "" {
+			return g, true
+		}
+		key = r.starAlias
 	}
+	g := r.Groups[key]
+	return g, g != nil
+}
 
-	if ret == nil {
-		return emptyGroup
+// productToken returns the product token agent starts with, the name of
+// the crawler: the letters, digits, "-" and "_" up to the first other
+// character, such as "googlebot" for "googlebot/2.1". RFC 9309 leaves out
+// digits, they are kept for crawlers such as "360spider". agent is lower
+// case.
+func productToken(agent string) string {
+	agent = strings.TrimSpace(agent)
+	for i := 0; i < len(agent); i++ {
+		if c := agent[i]; !('a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+			return agent[:i]
+		}
+	}
+	return agent
+}
+
+// agentRank tells how well name, the lower case agent of a group other
+// than "*", matches agent, lower case: zero if the group does not apply,
+// more for better matches.
+func (r *RobotsData) agentRank(agent, name string) int {
+	if name == "" {
+		return 0
+	}
+	if r.prefixAgents {
+		if strings.HasPrefix(agent, name) {
+			return len(name)
+		}
+		return 0
+	}
+	token := productToken(agent)
+	switch {
+	case token == "" || productToken(name) != token:
+		return 0
+	case name == token:
+		return 2
+	}
+	return 1
+}
+
+// findGroupScan is FindGroup without the index, agent is lower case.
+func (r *RobotsData) findGroupScan(agent string) (ret *Group) {
+	var best int
+
+	// "*" is the weakest match possible, any matching agent wins over it,
+	// even a single letter one.
+	ret = r.Groups["*"]
+	names := r.agentNames()
+	for _, a := range names {
+		if a == "*" {
+			continue
+		}
+		if l := r.agentRank(agent, a); l > best {
+			best, ret = l, r.Groups[a]
+		}
+	}
+	// Other Agents only win over better matches, keys take precedence.
+	for _, a := range names {
+		g := r.Groups[a]
+		for _, name := range g.Agents {
+			name = strings.ToLower(name)
+			if name == "*" {
+				if ret == nil {
+					ret = g
+				}
+				continue
+			}
+			if l := r.agentRank(agent, name); l > best {
+				best, ret = l, g
+			}
+		}
 	}
 	return
 }
 
+// agentIndex is an agent name FindGroup selects the group of key in Groups
+// for. Groups are looked up by key so that copies of the data with new
+// groups keep working.
+type agentIndex struct {
+	name, key string
+}
+
+// indexed reports whether r.agents can be used, that is Groups has the size
+// it had when the index was built. A key replaced by another one since is
+// caught by findGroupIndexed when the index leads to it.
+func (r *RobotsData) indexed() bool {
+	return r.agents != nil && len(r.Groups) == r.indexedSize
+}
+
+// indexAgents builds r.agents and r.tokens.
+func (r *RobotsData) indexAgents() {
+	agents := make([]agentIndex, 0, len(r.Groups))
+	seen := make(map[string]bool, len(r.Groups))
+	names := r.agentNames()
+	for _, a := range names {
+		if a != "*" && a != "" {
+			agents = append(agents, agentIndex{a, a})
+		}
+		seen[a] = true
+	}
+	r.starAlias = ""
+	for _, a := range names {
+		for _, name := range r.Groups[a].Agents {
+			name = strings.ToLower(name)
+			switch {
+			case seen[name]:
+			case name == "*":
+				r.starAlias = a
+			default:
+				agents = append(agents, agentIndex{name, a})
+			}
+			seen[name] = true
+		}
+	}
+
+	// Keys before other Agents, agents equal to their token first
+	r.tokens = make(map[string]string, len(agents))
+	for _, exact := range []bool{true, false} {
+		for _, a := range agents {
+			token := productToken(a.name)
+			if _, ok := r.tokens[token]; !ok && token != "" && (token == a.name) == exact {
+				r.tokens[token] = a.key
+			}
+		}
+	}
+
+	sort.SliceStable(agents, func(i, j int) bool {
+		if len(agents[i].name) != len(agents[j].name) {
+			return len(agents[i].name) > len(agents[j].name)
+		}
+		return agents[i].name < agents[j].name
+	})
+	r.agents, r.indexedSize = agents, len(r.Groups)
+}
+
+// FindRule returns the rule of g deciding path, nil if no rule matches and
+// path is allowed by default.
+func (g *Group) FindRule(path string) *Rule {
+	return g.findRule(path)
+}
+
 func (g *Group) Test(path string) bool {
 	if r := g.findRule(path); r != nil {
 		return r.Allow
@@ -196,32 +1278,213 @@ func (g *Group) Test(path string) bool {
 //
 // At a group-member level, in particular for Allow and disallow directives,
 // the most specific Rule based on the length of the [path] entry will trump
-// the less specific (shorter) Rule. The order of precedence for Rules with
-// wildcards is undefined.
-func (g *Group) findRule(path string) (ret *Rule) {
+// the less specific (shorter) Rule. In case of conflicting Rules, including
+// those with wildcards, the least restrictive Rule is used, unless g was
+// parsed with MatchLegacy.
+func (g *Group) findRule(path string) *Rule {
+	return g.findRuleTie(path, g.tie())
+}
+
+// tie returns how g breaks ties between matching rules.
+func (g *Group) tie() tieBreak {
+	if g.strategy == MatchLegacy {
+		return tieFirst
+	}
+	return tieAllow
+}
+
+// tieBreak decides between matching rules of equal specificity.
+type tieBreak int
+
+const (
+	tieFirst    tieBreak = iota // The rule listed first wins
+	tieAllow                    // Allow rules win
+	tieDisallow                 // Disallow rules win
+)
+
+// wins reports whether r, matching with specificity l, replaces the current
+// winner matching with specificity best.
+func (t tieBreak) wins(r *Rule, l int, current *Rule, best int) bool {
+	return l > best || (l > 0 && l == best && t.prefers(r, current))
+}
+
+// prefers reports whether r wins a tie against the current winner. Rules
+// of the group itself win over those inherited from "*".
+func (t tieBreak) prefers(r, current *Rule) bool {
+	if r.inherited != current.inherited {
+		return current.inherited
+	}
+	switch t {
+	case tieAllow:
+		return r.Allow && !current.Allow
+	case tieDisallow:
+		return !r.Allow && current.Allow
+	}
+	return false
+}
+
+func (g *Group) findRuleTie(path string, tie tieBreak) (ret *Rule) {
 	var prefixLen int
 
+	path = g.subject(path)
+	if g.index != nil && g.index.n == len(g.Rules) {
+		return g.findRuleIndexed(path, tie)
+	}
+
 	for _, r := range g.Rules {
-		if r.Pattern != nil {
-			if r.Pattern.MatchString(path) {
-				// Consider this a match equal to the length of the Pattern.
-				// From Google's spec:
-				// The order of precedence for Rules with wildcards is undefined.
-				if l := len(r.Pattern.String()); l > prefixLen {
-					prefixLen = l
-					ret = r
-				}
-			}
-		} else if r.Path == "/" && prefixLen == 0 {
-			// Weakest match possible
-			prefixLen = 1
+		if l := r.specificity(path); tie.wins(r, l, ret, prefixLen) {
+			prefixLen = l
 			ret = r
-		} else if strings.HasPrefix(path, r.Path) {
-			if l := len(r.Path); l > prefixLen {
-				prefixLen = l
-				ret = r
-			}
 		}
 	}
 	return
 }
+
+// subject returns path as matched against the rules of g: with the leading
+// "/" URL paths always have and the same percent-encoding as rule paths.
+func (g *Group) subject(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	if g.decodePaths {
+		return decodePath(path)
+	}
+	return normalizeEscapes(path)
+}
+
+// decodePath returns path with percent-encoding decoded, or path itself if
+// it is not validly encoded.
+func decodePath(path string) string {
+	if p, err := url.PathUnescape(path); err == nil {
+		return p
+	}
+	return path
+}
+
+// setOptions records the options of g that matching depends on.
+func (g *Group) setOptions(opts *ParseOptions) {
+	g.decodePaths = opts.DecodePaths
+	g.strategy = opts.MatchStrategy
+	for _, rule := range g.Rules {
+		rule.strategy = opts.MatchStrategy
+	}
+	for _, rule := range g.Noindex {
+		rule.strategy = opts.MatchStrategy
+	}
+}
+
+// matchStrategy returns the ParseOptions.MatchStrategy r was parsed with.
+func (r *RobotsData) matchStrategy() MatchStrategy {
+	for _, g := range r.Groups {
+		return g.strategy
+	}
+	return MatchRFC9309
+}
+
+// decodePaths reports whether r was parsed with ParseOptions.DecodePaths.
+func (r *RobotsData) decodePaths() bool {
+	for _, g := range r.Groups {
+		return g.decodePaths
+	}
+	return false
+}
+
+// normalizeEscapes returns path with uniform percent-encoding, so that
+// equivalent encodings compare equal: escaped unreserved characters are
+// decoded, other escapes use upper case hex digits, and non-ASCII bytes,
+// spaces and control characters are escaped. Reserved characters keep their
+// encoding, "%2F" and "/" are not the same path.
+func normalizeEscapes(path string) string {
+	i := 0
+	for ; i < len(path); i++ {
+		if c := path[i]; c == '%' || c <= ' ' || c >= 0x7f {
+			break
+		}
+	}
+	if i == len(path) {
+		return path
+	}
+	const hex = "0123456789ABCDEF"
+	b := make([]byte, i, len(path)+8)
+	copy(b, path)
+	for ; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case c == '%' && i+2 < len(path) && ishex(path[i+1]) && ishex(path[i+2]):
+			v := unhex(path[i+1])<<4 | unhex(path[i+2])
+			if isUnreserved(v) {
+				b = append(b, v)
+			} else {
+				b = append(b, '%', hex[v>>4], hex[v&15])
+			}
+			i += 2
+		case c <= ' ' || c >= 0x7f:
+			b = append(b, '%', hex[c>>4], hex[c&15])
+		default:
+			b = append(b, c)
+		}
+	}
+	return string(b)
+}
+
+func ishex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	}
+	return c - '0'
+}
+
+// isUnreserved reports whether c may appear unescaped anywhere in a URL
+// with the same meaning, per RFC 3986.
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// specificity returns how specific a match r is for path, zero if r does not
+// match path.
+func (r *Rule) specificity(path string) int {
+	switch {
+	case r.isPattern():
+		if r.matches(path) {
+			return r.weight()
+		}
+	case r.Path == "/":
+		// Weakest match possible
+		return 1
+	case strings.HasPrefix(path, r.Path):
+		return r.weight()
+	}
+	return 0
+}
+
+// weight is the specificity of r for any path it matches: the number of
+// octets of its path, wildcards included, "*" and "$" counting as one octet
+// each and percent-encoded characters as the octet they stand for. With
+// MatchLegacy, it is the length of the regexp of a path with wildcards.
+func (r *Rule) weight() int {
+	if r.strategy == MatchLegacy {
+		if r.Pattern != nil {
+			return len(r.Pattern.String())
+		}
+		if r.wild != nil {
+			return len(patternExpr(r.Path, 0))
+		}
+		return len(r.Path)
+	}
+	n := len(r.Path)
+	for i := 0; i+2 < len(r.Path); i++ {
+		if r.Path[i] == '%' && ishex(r.Path[i+1]) && ishex(r.Path[i+2]) {
+			n -= 2
+			i += 2
+		}
+	}
+	return n
+}
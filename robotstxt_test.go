@@ -1,12 +1,17 @@
 package robotstxt
 
 import (
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"testing/quick"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -42,6 +47,192 @@ func TestStatus(t *testing.T) {
 	}
 }
 
+func TestStatusPolicy(t *testing.T) {
+	t.Parallel()
+	policy := StatusPolicy{
+		ServerError: StatusAllowAll,
+		RateLimited: StatusDisallowAll,
+		Redirect:    StatusAllowAll,
+	}
+	cases := []struct {
+		code  int
+		allow bool
+	}{
+		{200, true},
+		{301, true},
+		{404, true},
+		{429, false},
+		{500, true},
+		{503, false},
+	}
+	for _, c := range cases {
+		r, err := FromStatusAndBytesWithOptions(c.code, nil, ParseOptions{StatusPolicy: policy})
+		require.NoError(t, err, c.code)
+		expectAll(t, r, c.allow)
+	}
+
+	_, err := FromStatusAndString(301, "")
+	assert.Error(t, err)
+	_, err = FromStatusAndBytesWithOptions(404, nil, ParseOptions{StatusPolicy: StatusPolicy{ClientError: StatusError}})
+	assert.Error(t, err)
+
+	// Retry-After is kept for 429 and 503 responses
+	res := newHttpResponse(429, "")
+	res.Header = http.Header{"Retry-After": {"120"}}
+	r, err := FromResponseWithOptions(res, ParseOptions{StatusPolicy: policy})
+	require.NoError(t, err)
+	assert.True(t, r.DisallowAll)
+	assert.Equal(t, 2*time.Minute, r.RetryAfter)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Hour, retryAfter(now.Add(time.Hour).Format(http.TimeFormat), now))
+	assert.Zero(t, retryAfter("soon", now))
+	assert.Zero(t, retryAfter("-5", now))
+
+	// Too many redirects read as a redirect
+	redirected := func(hops int) *http.Response {
+		res := newHttpResponse(200, "User-agent: *\nDisallow: /\n")
+		req := &http.Request{URL: &url.URL{Scheme: "https", Host: "example.com", Path: "/robots.txt"}}
+		for i := 0; i < hops; i++ {
+			req = &http.Request{URL: req.URL, Response: &http.Response{StatusCode: 301, Request: req}}
+		}
+		res.Request = req
+		return res
+	}
+	opts := ParseOptions{StatusPolicy: StatusPolicy{MaxRedirects: 2, Redirect: StatusAllowAll}}
+	r, err = FromResponseWithOptions(redirected(2), opts)
+	require.NoError(t, err)
+	expectAll(t, r, false)
+	r, err = FromResponseWithOptions(redirected(3), opts)
+	require.NoError(t, err)
+	expectAll(t, r, true)
+}
+
+func TestChunkedResponse(t *testing.T) {
+	t.Parallel()
+	const body = "User-agent: *\nDisallow: /private\nSitemap: http://example.com/sitemap.xml"
+	expect, err := FromString(body)
+	require.NoError(t, err)
+	for i, tail := range []string{"", "\n", "\r\n\r\n", " \t\n  \n", "\n\n\n\t"} {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			res := newChunkedResponse(200, body+tail)
+			r, err := FromResponse(res)
+			require.NoError(t, err)
+			assert.Equal(t, expect.Groups, r.Groups)
+			assert.Equal(t, expect.Sitemaps, r.Sitemaps)
+		})
+	}
+	for i, blank := range []string{"", "\r\n", "  \n\t\n \r\n"} {
+		t.Run("blank-"+strconv.Itoa(i), func(t *testing.T) {
+			r, err := FromResponse(newChunkedResponse(200, blank))
+			require.NoError(t, err)
+			assert.True(t, r.AllowAll)
+		})
+	}
+}
+
+func TestFromReader(t *testing.T) {
+	t.Parallel()
+	const body = "User-agent: *\nDisallow: /private\n"
+	r, err := FromReader(iotest.OneByteReader(strings.NewReader(body)))
+	require.NoError(t, err)
+	expectAccess(t, r, false, "/private", "bot")
+
+	r, err = FromReaderWithLimit(strings.NewReader(body), int64(len(body)))
+	require.NoError(t, err)
+	expectAccess(t, r, false, "/private", "bot")
+
+	src := strings.NewReader(body + strings.Repeat("# padding\n", 1000))
+	r, err = FromReaderWithLimit(src, int64(len(body)))
+	assert.Equal(t, ErrBodyTooLarge, err)
+	assert.Nil(t, r)
+	// The rest of the body was not read
+	assert.True(t, src.Len() > 9000)
+
+	_, err = FromResponseWithOptions(newHttpResponse(200, body), ParseOptions{MaxBytes: 10})
+	assert.Equal(t, ErrBodyTooLarge, err)
+	r, err = FromResponseWithOptions(newHttpResponse(404, body), ParseOptions{MaxBytes: 10})
+	require.NoError(t, err)
+	assert.True(t, r.AllowAll)
+}
+
+func TestFromReaderChunks(t *testing.T) {
+	t.Parallel()
+	var b strings.Builder
+	for i := 0; b.Len() < 3*readChunk; i++ {
+		fmt.Fprintf(&b, "# group %d\r\nUser-agent: bot%d\r\nDisallow: /private/%d # comment\n\n  \nAllow: /p\u00e9/%d\rCrawl-delay: %d\n", i, i, i, i, i%10)
+	}
+	body := b.String()
+	for _, opts := range []ParseOptions{{}, {MaxParseBytes: 2*readChunk + 7}, {Repair: true}} {
+		want, err := FromBytesWithOptions([]byte(body), opts)
+		require.NoError(t, err)
+		got, err := FromReaderWithOptions(iotest.HalfReader(strings.NewReader(body)), opts)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	// The limit is enforced while reading
+	src := &endlessReader{line: "Disallow: /private\n"}
+	_, err := FromReaderWithLimit(io.MultiReader(strings.NewReader("User-agent: *\n"), src), 3*readChunk)
+	assert.Equal(t, ErrBodyTooLarge, err)
+	assert.True(t, src.read <= 3*readChunk+1)
+	src = &endlessReader{line: "Disallow: /private\n"}
+	_, err = FromReaderWithOptions(src, ParseOptions{MaxParseBytes: readChunk, MaxBytes: 3 * readChunk})
+	assert.Equal(t, ErrBodyTooLarge, err)
+
+	// HTML is recognized in the first chunk
+	r, err := FromReaderWithOptions(strings.NewReader("<html>"+body), ParseOptions{RejectHTML: true})
+	require.NoError(t, err)
+	assert.True(t, r.AllowAll)
+	require.Len(t, r.Warnings, 1)
+	assert.Equal(t, WarnHTML, r.Warnings[0].Kind)
+}
+
+// endlessReader repeats a line forever.
+type endlessReader struct {
+	line string
+	read int
+}
+
+func (e *endlessReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		c := copy(p[n:], e.line[e.read%len(e.line):])
+		n += c
+		e.read += c
+	}
+	return n, nil
+}
+
+func TestMaxParseBytes(t *testing.T) {
+	t.Parallel()
+	src := &endlessReader{line: "Disallow: /private\n"}
+	r, err := FromReader(io.MultiReader(strings.NewReader("User-agent: *\n"), src))
+	require.NoError(t, err)
+	expectAccess(t, r, false, "/private", "bot")
+	assert.True(t, src.read <= DefaultMaxParseBytes+1)
+	rules := r.FindGroup("bot").Rules
+	require.NotEmpty(t, rules)
+	require.Len(t, r.Warnings, 1)
+	w := r.Warnings[0]
+	assert.Equal(t, WarnTruncated, w.Kind)
+	assert.Equal(t, rules[len(rules)-1].Line+1, w.Line)
+
+	const body = "User-agent: *\r\nDisallow: /a\rDisallow: /b\nDisallow: /c\n"
+	var log testLogger
+	r, err = FromBytesWithOptions([]byte(body), ParseOptions{Logger: &log, MaxParseBytes: int64(len(body) - 3)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Disallow: /a", "Disallow: /b"}, ruleStrings(r.FindGroup("bot")))
+	require.Len(t, r.Warnings, 1)
+	assert.Equal(t, 4, r.Warnings[0].Line)
+	require.Len(t, log.messages, 1)
+	assert.Contains(t, log.messages[0], "larger than")
+
+	r, err = FromReaderWithOptions(strings.NewReader(body), ParseOptions{MaxParseBytes: -1})
+	require.NoError(t, err)
+	assert.Len(t, r.FindGroup("bot").Rules, 3)
+	assert.Empty(t, r.Warnings)
+}
+
 func TestFromStringDisallowAll(t *testing.T) {
 	r, err := FromString("User-Agent: *\r\nDisallow: /\r\n")
 	require.NoError(t, err)
@@ -102,6 +293,85 @@ func TestAllowAll(t *testing.T) {
 	}
 }
 
+func TestSlashlessPath(t *testing.T) {
+	t.Parallel()
+	r, err := FromString("User-agent: *\nDisallow: /foo/bar\nAllow: /foo/bar/baz$\n")
+	require.NoError(t, err)
+	expectAccess(t, r, false, "foo/bar", "bot")
+	expectAccess(t, r, false, "foo/bar/x", "bot")
+	expectAccess(t, r, true, "foo/bar/baz", "bot")
+	expectAccess(t, r, true, "foo", "bot")
+	expectAccess(t, r, true, "", "bot")
+	steps := r.MatchTrace("foo/bar", "bot")
+	require.Len(t, steps, 2)
+	assert.True(t, steps[0].Winner)
+}
+
+func TestAgentCaseInsensitive(t *testing.T) {
+	t.Parallel()
+	const robotsCaseMixed = `User-agent: GoogleBot
+Disallow: /google
+
+User-agent: googlebot-NEWS
+Disallow: /news
+
+User-agent: *
+Disallow: /all
+`
+	r, err := FromString(robotsCaseMixed)
+	require.NoError(t, err)
+	require.Len(t, r.Groups, 3)
+	assert.Equal(t, "GoogleBot", r.Groups["googlebot"].Agent)
+	assert.Equal(t, "googlebot-NEWS", r.Groups["googlebot-news"].Agent)
+	cases := []struct {
+		agent string
+		path  string
+	}{
+		{"Googlebot", "/google"},
+		{"googlebot", "/google"},
+		{"GOOGLEBOT/2.1", "/google"},
+		{"Googlebot-News", "/news"},
+		{"GOOGLEBOT-news", "/news"},
+		{"Bingbot", "/all"},
+		{"BINGBOT", "/all"},
+	}
+	for _, c := range cases {
+		for _, p := range []string{"/google", "/news", "/all"} {
+			expectAccess(t, r, p != c.path, p, c.agent)
+		}
+	}
+}
+
+func TestGroupBoundaries(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		name  string
+		input string
+	}{
+		{"comment", "User-agent: a\nDisallow: /a\n# b follows\nUser-agent: b\nDisallow: /b\n"},
+		{"no-blank-line", "User-agent: a\nDisallow: /a\nUser-agent: b\nDisallow: /b\n"},
+		{"comment-and-blank", "User-agent: a\nDisallow: /a\n\n# b follows\n\nUser-agent: b\nDisallow: /b\n"},
+		{"empty-comment", "User-agent: a\nDisallow: /a\n#\nUser-agent: b\nDisallow: /b\n"},
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			r, err := FromString(c.input)
+			require.NoError(t, err)
+			expectAccess(t, r, false, "/a", "a")
+			expectAccess(t, r, true, "/b", "a")
+			expectAccess(t, r, true, "/a", "b")
+			expectAccess(t, r, false, "/b", "b")
+		})
+	}
+
+	// A comment between user-agent lines does not end the group
+	r, err := FromString("User-agent: a\n# and\nUser-agent: b\nDisallow: /x\n")
+	require.NoError(t, err)
+	expectAccess(t, r, false, "/x", "a")
+	expectAccess(t, r, false, "/x", "b")
+}
+
 func TestRobotstxtOrg(t *testing.T) {
 	t.Parallel()
 	const robotsText005 = `User-agent: Google
@@ -111,9 +381,38 @@ Disallow: /`
 	r, err := FromString(robotsText005)
 	require.NoError(t, err)
 	expectAccess(t, r, false, "/Path/page1.html", "SomeBot")
+	// Google is not the product token of Googlebot
+	expectAccess(t, r, false, "/Path/page1.html", "Googlebot")
+	expectAccess(t, r, true, "/Path/page1.html", "Google/1.0")
+	require.Contains(t, r.Groups, "google")
+	assert.Empty(t, r.Groups["google"].Rules)
+
+	r, err = FromBytesWithOptions([]byte(robotsText005), ParseOptions{PrefixAgentMatch: true})
+	require.NoError(t, err)
 	expectAccess(t, r, true, "/Path/page1.html", "Googlebot")
 }
 
+func TestDirectiveCase(t *testing.T) {
+	t.Parallel()
+	var rules [][]*Rule
+	for _, key := range []string{"DISALLOW", "disallow", "Disallow", "DisAllow"} {
+		r, err := FromString("USER-AGENT: *\n" + key + ": /Private/*.PHP$\n" + key + ": /Tmp\n")
+		require.NoError(t, err)
+		g := r.FindGroup("bot")
+		require.Len(t, g.Rules, 2, key)
+		assert.Equal(t, "/Private/*.PHP$", g.Rules[0].Path, key)
+		assert.Equal(t, "/Tmp", g.Rules[1].Path, key)
+		expectAccess(t, r, false, "/Private/a.PHP", "bot")
+		expectAccess(t, r, true, "/private/a.php", "bot")
+		expectAccess(t, r, false, "/Tmp", "bot")
+		expectAccess(t, r, true, "/tmp", "bot")
+		rules = append(rules, g.Rules)
+	}
+	for _, r := range rules[1:] {
+		assert.Equal(t, rules[0], r)
+	}
+}
+
 func TestHost(t *testing.T) {
 	type tcase struct {
 		input  string
@@ -133,6 +432,79 @@ func TestHost(t *testing.T) {
 	}
 }
 
+func TestPreferredHost(t *testing.T) {
+	t.Parallel()
+	cases := map[string]string{
+		"":                                "",
+		"Host: Example.com":               "example.com",
+		"Host: example.com:8080":          "example.com:8080",
+		"Host: https://example.com:8443/": "example.com:8443",
+		"Host: [::1]:8080":                "[::1]:8080",
+	}
+	for input, host := range cases {
+		r, err := FromString(input)
+		require.NoError(t, err)
+		assert.Equal(t, host, r.PreferredHost(), input)
+	}
+	r, err := FromString("Host: example.com:8080")
+	require.NoError(t, err)
+	assert.False(t, r.HostMismatch("http://example.com:8080/"))
+	assert.True(t, r.HostMismatch("http://example.com/"))
+}
+
+func TestHostMismatch(t *testing.T) {
+	t.Parallel()
+	type tcase struct {
+		host     string
+		url      string
+		mismatch bool
+	}
+	cases := []tcase{
+		{"example.com", "https://example.com/page", false},
+		{"example.com", "http://EXAMPLE.com:8080/page", false},
+		{"https://www.example.com/", "https://www.example.com/", false},
+		{"example.com", "https://www.example.com/page", true},
+		{"example.com", "https://mirror.example.org/", true},
+		{"example.com:8080", "http://example.com:8080/", false},
+		{"example.com:8080", "http://example.com/", true},
+		{"example.com", "/relative", true},
+		{"", "https://anything.example.org/", false},
+	}
+	for _, c := range cases {
+		r, err := FromString("Host: " + c.host)
+		require.NoError(t, err)
+		assert.Equal(t, c.mismatch, r.HostMismatch(c.url), "host=%s url=%s", c.host, c.url)
+	}
+}
+
+func TestWithRedirectChain(t *testing.T) {
+	t.Parallel()
+	// http://example.com/robots.txt redirected to https://www.example.com/robots.txt
+	r, err := FromString("User-agent: *\nDisallow: /private\n")
+	require.NoError(t, err)
+	const fetched = "https://www.example.com/robots.txt"
+
+	allowed, err := r.TestWithRedirectChain("https://www.example.com/private/a", fetched, "bot")
+	require.NoError(t, err)
+	assert.False(t, allowed)
+	allowed, err = r.TestWithRedirectChain("https://WWW.example.com:443/public", fetched, "bot")
+	require.NoError(t, err)
+	assert.True(t, allowed)
+
+	for _, u := range []string{
+		"http://example.com/public",
+		"http://www.example.com/public",
+		"https://www.example.com:8443/public",
+	} {
+		allowed, err = r.TestWithRedirectChain(u, fetched, "bot")
+		assert.Equal(t, ErrOtherOrigin, err, u)
+		assert.False(t, allowed, u)
+	}
+
+	_, err = r.TestWithRedirectChain("http://[::1", fetched, "bot")
+	assert.Error(t, err)
+}
+
 func TestParseErrors(t *testing.T) {
 	t.Parallel()
 	cases := []struct {
@@ -143,11 +515,13 @@ func TestParseErrors(t *testing.T) {
 		{"disallow-before", "Disallow: /\nUser-agent: bot", "Disallow before User-agent"},
 		{"crawl-delay-syntax", "User-agent: bot\nCrawl-delay: bad-time-value", "invalid syntax"},
 		{"crawl-delay-inf", "User-agent: bot\nCrawl-delay: -inf", "invalid value"},
+		{"path-space", "User-agent: bot\nDisallow: /my page", "contains whitespace"},
+		{"empty-agent", "User-agent:\nDisallow: /", "User-agent without value"},
 	}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
 			t.Log("input:", c.input)
-			_, err := FromString(c.input)
+			_, err := FromBytesWithOptions([]byte(c.input), ParseOptions{Strict: true})
 			require.Error(t, err)
 			_, ok := err.(*ParseError)
 			assert.True(t, ok, "Expected ParseError")
@@ -156,6 +530,239 @@ func TestParseErrors(t *testing.T) {
 	}
 }
 
+func TestParseRecovery(t *testing.T) {
+	t.Parallel()
+	const robotsCaseGarbage = "User-agent: *\nDisallow: /private\nCrawl-delay: soon\nAllow: /private/public\n\nUser-agent: a\nDisallow: /a\n"
+	r, err := FromString(robotsCaseGarbage)
+	require.NoError(t, err)
+	expectAccess(t, r, false, "/private", "bot")
+	expectAccess(t, r, true, "/private/public", "bot")
+	expectAccess(t, r, false, "/a", "a")
+	assert.Equal(t, time.Duration(0), r.Groups["*"].CrawlDelay)
+	require.Len(t, r.Warnings, 1)
+	assert.Equal(t, 3, r.Warnings[0].Line)
+	assert.Contains(t, r.Warnings[0].String(), "line 3: ")
+	assert.Contains(t, r.Warnings[0].Message, "soon")
+
+	r, err = FromString("User-agent: *\nDisallow: /\n")
+	require.NoError(t, err)
+	assert.Empty(t, r.Warnings)
+}
+
+func TestWarnings(t *testing.T) {
+	t.Parallel()
+	const robotsCaseWarnings = `Disallow: /early
+User-agent: a
+User-agent:
+Crawl-delay: soon
+Noise: here
+Disallow: /my page
+Sitemap: ftp://example.com/s.xml
+Request-rate: fast
+`
+	var log testLogger
+	r, err := FromBytesWithOptions([]byte(robotsCaseWarnings), ParseOptions{Logger: &log, Repair: true})
+	require.NoError(t, err)
+	expected := []struct {
+		line int
+		kind WarningKind
+		text string
+	}{
+		{1, WarnNoGroup, "Disallow: /early"},
+		{3, WarnEmptyValue, "User-agent"},
+		{4, WarnMalformed, "Crawl-delay: soon"},
+		{5, WarnUnknownDirective, "Noise: here"},
+		{6, WarnRewritten, "Disallow: /my page"},
+		{7, WarnInvalidSitemap, "Sitemap: ftp://example.com/s.xml"},
+		{8, WarnIgnoredValue, "Request-rate: fast"},
+	}
+	require.Len(t, r.Warnings, len(expected))
+	for i, e := range expected {
+		w := r.Warnings[i]
+		assert.Equal(t, e.line, w.Line, "warning %d", i)
+		assert.Equal(t, e.kind, w.Kind, "warning %d", i)
+		assert.Equal(t, e.text, w.Text, "warning %d", i)
+	}
+	// Sitemaps are only checked once parsed, they are not logged
+	assert.Len(t, log.messages, len(expected)-1)
+	assert.Equal(t, "unknown-directive", WarnUnknownDirective.String())
+	assert.Equal(t, "unknown", WarningKind(-1).String())
+	expectAccess(t, r, false, "/early", "bot")
+	expectAccess(t, r, false, "/my%20page", "a")
+}
+
+func TestEmptyAgentLenient(t *testing.T) {
+	t.Parallel()
+	var log testLogger
+	r, err := FromBytesWithOptions([]byte("User-agent: a\nUser-agent:\nDisallow: /\nSitemap:\n"), ParseOptions{Logger: &log})
+	require.NoError(t, err)
+	require.Len(t, r.Groups, 1)
+	assert.Contains(t, r.Groups, "a")
+	assert.Empty(t, r.Sitemaps)
+	expectAccess(t, r, false, "/", "a")
+	expectAccess(t, r, true, "/", "b")
+	require.Len(t, log.messages, 1)
+	assert.Contains(t, log.messages[0], "without value")
+
+	// Starting its own block, it ends the previous group and its members
+	// apply to nobody
+	r, err = FromString("User-agent: a\nDisallow: /x\n\nUser-agent:\nDisallow: /\n\nUser-agent: b\nDisallow: /b\n")
+	require.NoError(t, err)
+	expectAccess(t, r, false, "/x", "a")
+	expectAccess(t, r, true, "/y", "a")
+	expectAccess(t, r, false, "/b", "b")
+	expectAccess(t, r, true, "/y", "b")
+	expectAccess(t, r, true, "/", "other")
+	assert.Equal(t, []string{"Disallow: /x"}, ruleStrings(r.Groups["a"]))
+
+	r, err = FromString("User-agent:\nDisallow: /\nCrawl-delay: 5\n")
+	require.NoError(t, err)
+	assert.Empty(t, r.Groups)
+	expectAccess(t, r, true, "/", "other")
+}
+
+func TestUnicodeSpaceLenient(t *testing.T) {
+	t.Parallel()
+	var log testLogger
+	r, err := FromBytesWithOptions([]byte("User-agent:\u00a0a\nDisallow:\u00a0/private\u00a0\nAllow: /private/public\n"), ParseOptions{Logger: &log, Repair: true})
+	require.NoError(t, err)
+	assert.Contains(t, r.Groups, "a")
+	rules := r.FindGroup("a").Rules
+	require.Len(t, rules, 2)
+	assert.Equal(t, "/private", rules[0].Path)
+	expectAccess(t, r, false, "/private", "a")
+	expectAccess(t, r, true, "/private/public", "a")
+	require.Len(t, log.messages, 2)
+	assert.Contains(t, log.messages[0], "U+00A0")
+	require.Len(t, r.Warnings, 2)
+	assert.Equal(t, WarnUnicodeSpace, r.Warnings[1].Kind)
+	assert.Equal(t, 2, r.Warnings[1].Line)
+
+	// Strict parsing keeps the no-break space as part of the value
+	r, err = FromBytesWithOptions([]byte("User-agent: *\nDisallow:\u00a0/private\n"), ParseOptions{Strict: true})
+	require.NoError(t, err)
+	expectAccess(t, r, true, "/private", "bot")
+}
+
+func TestSplitDuplicateAgents(t *testing.T) {
+	t.Parallel()
+	const robots = "User-agent: Googlebot\nDisallow: /a\n\nUser-agent: *\nDisallow: /\n\nUser-agent: googlebot\nUser-agent: bingbot\nDisallow: /b\n"
+
+	r, err := FromString(robots)
+	require.NoError(t, err)
+	assert.Empty(t, r.DuplicateGroups)
+	assert.Equal(t, []string{"Disallow: /a", "Disallow: /b"}, ruleStrings(r.Groups["googlebot"]))
+	expectAccess(t, r, false, "/b", "Googlebot")
+	expectAccess(t, r, false, "/b", "Bingbot")
+
+	r, err = FromBytesWithOptions([]byte(robots), ParseOptions{Strict: true, SplitDuplicateAgents: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Disallow: /a"}, ruleStrings(r.Groups["googlebot"]))
+	require.Len(t, r.DuplicateGroups, 1)
+	assert.Equal(t, "googlebot", r.DuplicateGroups[0].Agent)
+	assert.Equal(t, []string{"Disallow: /b"}, ruleStrings(r.DuplicateGroups[0]))
+	expectAccess(t, r, false, "/a", "Googlebot")
+	expectAccess(t, r, true, "/b", "Googlebot")
+	expectAccess(t, r, false, "/b", "Bingbot")
+}
+
+func TestColonComments(t *testing.T) {
+	t.Parallel()
+	const robotsCaseComments = `# see: https://example.com/robots-policy
+User-agent: a # contact: admin@example.com
+# Disallow: /commented
+Disallow: /private # reason: staging
+#Allow: /private
+Crawl-delay: 2 # unit: seconds
+`
+	r, err := FromString(robotsCaseComments)
+	require.NoError(t, err)
+	require.Len(t, r.Groups, 1)
+	g := r.Groups["a"]
+	require.NotNil(t, g)
+	assert.Equal(t, []string{"Disallow: /private"}, ruleStrings(g))
+	assert.Equal(t, 2*time.Second, g.CrawlDelay)
+	expectAccess(t, r, true, "/commented", "a")
+	expectAccess(t, r, false, "/private", "a")
+}
+
+func TestFirstGroupAsDefault(t *testing.T) {
+	t.Parallel()
+	const robots = "User-agent: b\nDisallow: /b\n\nUser-agent: a\nDisallow: /a\n"
+
+	r, err := FromString(robots)
+	require.NoError(t, err)
+	expectAccess(t, r, true, "/b", "other")
+	expectAccess(t, r, true, "/a", "other")
+
+	r, err = FromBytesWithOptions([]byte(robots), ParseOptions{Strict: true, FirstGroupAsDefault: true})
+	require.NoError(t, err)
+	assert.Equal(t, r.Groups["b"], r.FindGroup("other"))
+	expectAccess(t, r, false, "/b", "other")
+	expectAccess(t, r, true, "/a", "other")
+	expectAccess(t, r, false, "/a", "a")
+
+	// A "*" group is still the default
+	r, err = FromBytesWithOptions([]byte(robots+"\nUser-agent: *\nDisallow: /star\n"), ParseOptions{FirstGroupAsDefault: true})
+	require.NoError(t, err)
+	expectAccess(t, r, true, "/b", "other")
+	expectAccess(t, r, false, "/star", "other")
+}
+
+func TestPathSpaceLenient(t *testing.T) {
+	t.Parallel()
+	var log testLogger
+	r, err := FromBytesWithOptions([]byte("User-agent: *\nDisallow: /my page\nAllow: /my page/public\n"), ParseOptions{Logger: &log, Repair: true})
+	require.NoError(t, err)
+	rules := r.FindGroup("bot").Rules
+	require.Len(t, rules, 2)
+	assert.Equal(t, "/my%20page", rules[0].Path)
+	assert.Equal(t, "/my%20page/public", rules[1].Path)
+	expectAccess(t, r, false, "/my%20page", "bot")
+	expectAccess(t, r, true, "/my%20page/public", "bot")
+	expectAccess(t, r, true, "/my", "bot")
+	require.Len(t, log.messages, 2)
+	assert.Contains(t, log.messages[0], "whitespace")
+
+	r, err = FromString("User-agent: *\nDisallow: /my page\n")
+	require.NoError(t, err)
+	assert.Empty(t, r.FindGroup("bot").Rules)
+}
+
+func TestParseLenient(t *testing.T) {
+	t.Parallel()
+	var log testLogger
+	r, err := FromBytesWithOptions([]byte("User-agent: *\nCrawl-delay: soon\nDisallow: /b"), ParseOptions{Logger: &log})
+	require.NoError(t, err)
+	expectAccess(t, r, false, "/b", "bot")
+	assert.Len(t, log.messages, 1)
+}
+
+func TestParseImplicitGroup(t *testing.T) {
+	t.Parallel()
+	const robotsCaseNoAgent = "Disallow: /a\nAllow: /a/public\nCrawl-delay: 1\n\nUser-agent: bot\nDisallow: /b"
+	var log testLogger
+	r, err := FromBytesWithOptions([]byte(robotsCaseNoAgent), ParseOptions{Logger: &log, Repair: true})
+	require.NoError(t, err)
+	expectAccess(t, r, false, "/a", "other")
+	expectAccess(t, r, true, "/a/public", "other")
+	expectAccess(t, r, true, "/a", "bot")
+	expectAccess(t, r, false, "/b", "bot")
+	assert.Equal(t, time.Second, r.FindGroup("other").CrawlDelay)
+	require.Len(t, log.messages, 1)
+	assert.Contains(t, log.messages[0], "before User-agent")
+
+	_, err = FromBytesWithOptions([]byte(robotsCaseNoAgent), ParseOptions{Strict: true})
+	require.Error(t, err)
+
+	// By default the lines before any User-agent are skipped
+	r, err = FromString("Disallow: /\n\nUser-agent: googlebot\nAllow: /\n")
+	require.NoError(t, err)
+	expectAccess(t, r, true, "/", "bingbot")
+	require.Len(t, r.Warnings, 1)
+	assert.Equal(t, WarnMalformed, r.Warnings[0].Kind)
+}
+
 const robotsTextJustHTML = `<!DOCTYPE html>
 <html>
 <title></title>
@@ -230,6 +837,621 @@ disallow: /c`
 	expectAccess(t, r, false, "/c", "c")
 }
 
+func TestTestExact(t *testing.T) {
+	t.Parallel()
+	r, err := FromString("User-agent: *\nDisallow: /private\nAllow: /private/ok\n")
+	require.NoError(t, err)
+	type tcase struct {
+		path       string
+		allowed    bool
+		determined bool
+	}
+	cases := []tcase{
+		{"/private", false, true},
+		{"/private/ok", true, true},
+		{"/public", true, false},
+	}
+	for _, c := range cases {
+		allowed, determined := r.TestExact(c.path, "bot")
+		assert.Equal(t, c.allowed, allowed, c.path)
+		assert.Equal(t, c.determined, determined, c.path)
+	}
+
+	r, err = FromStatusAndString(404, "")
+	require.NoError(t, err)
+	allowed, determined := r.TestExact("/", "bot")
+	assert.True(t, allowed)
+	assert.False(t, determined)
+}
+
+func TestTestWithTieBreaker(t *testing.T) {
+	t.Parallel()
+	for _, input := range []string{
+		"User-agent: *\nAllow: /page\nDisallow: /page\n",
+		"User-agent: *\nDisallow: /page\nAllow: /page\n",
+	} {
+		r, err := FromString(input)
+		require.NoError(t, err)
+		assert.True(t, r.TestWithTieBreaker("/page", "bot", true), input)
+		assert.False(t, r.TestWithTieBreaker("/page", "bot", false), input)
+		assert.False(t, r.TestWithTieBreaker("/page/1", "bot", false), input)
+		assert.True(t, r.TestWithTieBreaker("/other", "bot", false), input)
+	}
+
+	// Longest match still takes precedence
+	r, err := FromString("User-agent: *\nDisallow: /\nAllow: /public\n")
+	require.NoError(t, err)
+	assert.True(t, r.TestWithTieBreaker("/public/1", "bot", false))
+	assert.False(t, r.TestWithTieBreaker("/private", "bot", true))
+}
+
+func TestGroupAgents(t *testing.T) {
+	t.Parallel()
+	const robotsCaseAgents = "User-agent: Googlebot\nUser-agent: bingbot, Slurp\nDisallow: /private\n\n" +
+		"User-agent: googlebot\nUser-agent: Yandex\nDisallow: /tmp\n\nUser-agent: *\nDisallow: /\n"
+	r, err := FromBytesWithOptions([]byte(robotsCaseAgents), ParseOptions{Repair: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Googlebot", "bingbot", "Slurp", "Yandex"}, r.Groups["googlebot"].Agents)
+	assert.Equal(t, []string{"Googlebot", "bingbot", "Slurp"}, r.Groups["slurp"].Agents)
+	assert.Equal(t, []string{"googlebot", "Yandex"}, r.Groups["yandex"].Agents)
+	assert.Equal(t, []string{"*"}, r.Groups["*"].Agents)
+	for _, agent := range []string{"Googlebot", "Bingbot", "Slurp"} {
+		expectAccess(t, r, false, "/private", agent)
+		expectAccess(t, r, true, "/public", agent)
+	}
+
+	// A group built by hand is found for all its agents
+	g := &Group{Agent: "a", Agents: []string{"a", "bee", "*"}, Rules: []*Rule{{Path: "/x"}}}
+	other := &Group{Agent: "bee-news", Rules: []*Rule{{Path: "/y"}}}
+	r = &RobotsData{Groups: map[string]*Group{"a": g, "bee-news": other}}
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, g, r.FindGroup("Bee/1.0"), "indexed %v", i == 1)
+		assert.Equal(t, g, r.FindGroup("other"), "indexed %v", i == 1)
+		assert.Equal(t, other, r.FindGroup("bee-news"), "indexed %v", i == 1)
+		r.indexAgents()
+	}
+}
+
+func TestProductTokenMatch(t *testing.T) {
+	t.Parallel()
+	const robotsCaseTokens = `User-agent: Googlebot
+Disallow: /googlebot
+
+User-agent: googlebot-news
+Disallow: /news
+
+User-agent: Foo
+Disallow: /foo
+
+User-agent: Bar/2.0
+Disallow: /bar
+
+User-agent: *
+Disallow: /star
+`
+	cases := []struct {
+		agent  string
+		token  string // Group selected by token
+		prefix string // Group selected by prefix
+	}{
+		{"Googlebot", "googlebot", "googlebot"},
+		{"googlebot/2.1", "googlebot", "googlebot"},
+		{"GOOGLEBOT", "googlebot", "googlebot"},
+		{" Googlebot/2.1 (+http://www.google.com/bot.html)", "googlebot", "*"},
+		{"Googlebot-News", "googlebot-news", "googlebot-news"},
+		{"Googlebot-Image/1.0", "*", "googlebot"},
+		{"Googlebot_Image", "*", "googlebot"},
+		{"FooBot", "*", "foo"},
+		{"Foo", "foo", "foo"},
+		{"foo/1.0", "foo", "foo"},
+		{"Bar", "bar/2.0", "*"},
+		{"Bar/1.0", "bar/2.0", "*"},
+		{"Bar/2.0", "bar/2.0", "bar/2.0"},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1)", "*", "*"},
+		{"", "*", "*"},
+		{"/", "*", "*"},
+	}
+	check := func(r *RobotsData, prefix bool) {
+		for _, c := range cases {
+			want := c.token
+			if prefix {
+				want = c.prefix
+			}
+			assert.Equal(t, r.Groups[want], r.FindGroup(c.agent), "%q prefix %v", c.agent, prefix)
+			// The same without the index
+			s := &RobotsData{Groups: r.Groups, prefixAgents: r.prefixAgents}
+			assert.Equal(t, r.Groups[want], s.FindGroup(c.agent), "%q prefix %v scan", c.agent, prefix)
+		}
+	}
+	r, err := FromString(robotsCaseTokens)
+	require.NoError(t, err)
+	check(r, false)
+	r, err = FromBytesWithOptions([]byte(robotsCaseTokens), ParseOptions{PrefixAgentMatch: true})
+	require.NoError(t, err)
+	check(r, true)
+
+	// A group named exactly by the token wins over others with that token
+	r, err = FromString("User-agent: bot/1.0\nDisallow: /a\n\nUser-agent: bot\nDisallow: /b\n")
+	require.NoError(t, err)
+	for _, agent := range []string{"bot", "bot/1.0", "Bot/2.0"} {
+		assert.Equal(t, r.Groups["bot"], r.FindGroup(agent), agent)
+	}
+}
+
+func TestMatchStrategy(t *testing.T) {
+	t.Parallel()
+	legacy := ParseOptions{MatchStrategy: MatchLegacy}
+	cases := []struct {
+		robots string
+		path   string
+		rfc    bool
+		legacy bool
+	}{
+		// Ties go to Allow, or to the first rule
+		{"Disallow: /page\nAllow: /page\n", "/page", true, false},
+		{"Allow: /page\nDisallow: /page\n", "/page", true, true},
+		// "%2F" counts as one octet
+		{"Allow: /x%2Fy\nDisallow: /x*yz\n", "/x%2Fyz", false, false},
+		// Wildcards count as one octet, not as the length of their regexp
+		{"Allow: /a/b/c\nDisallow: /a*/c\n", "/a/b/c", true, false},
+	}
+	for _, c := range cases {
+		input := "User-agent: *\n" + c.robots
+		r, err := FromString(input)
+		require.NoError(t, err)
+		assert.Equal(t, c.rfc, r.TestAgent(c.path, "bot"), input)
+		r, err = FromBytesWithOptions([]byte(input), legacy)
+		require.NoError(t, err)
+		assert.Equal(t, c.legacy, r.TestAgent(c.path, "bot"), "legacy %s", input)
+	}
+
+	// Rules added later follow the strategy of the data
+	r, err := FromBytesWithOptions([]byte("User-agent: *\nDisallow: /page\n"), legacy)
+	require.NoError(t, err)
+	require.NoError(t, r.AddRule("*", "/page", true))
+	expectAccess(t, r, false, "/page", "bot")
+}
+
+func TestAgentDefault(t *testing.T) {
+	t.Parallel()
+	r, err := FromString("User-agent: *\nDisallow: /private\nAllow: /public\n")
+	require.NoError(t, err)
+	for _, def := range []bool{true, false} {
+		assert.Equal(t, def, r.TestAgentDefault("/other", "bot", def))
+		assert.False(t, r.TestAgentDefault("/private", "bot", def))
+		assert.True(t, r.TestAgentDefault("/public", "bot", def))
+	}
+	assert.True(t, r.TestAgent("/other", "bot"))
+
+	r, err = FromString("")
+	require.NoError(t, err)
+	assert.True(t, r.TestAgentDefault("/other", "bot", false))
+}
+
+func TestMostSpecificRule(t *testing.T) {
+	t.Parallel()
+	r, err := FromString("User-agent: *\nDisallow: /page\nAllow: /page\nAllow: /page/sub\nDisallow: /x\n")
+	require.NoError(t, err)
+
+	rule, tied := r.MostSpecificRule("/page", "bot")
+	require.NotNil(t, rule)
+	assert.True(t, tied)
+	assert.Equal(t, 3, rule.Line)
+	assert.True(t, rule.Allow)
+
+	rule, tied = r.MostSpecificRule("/page/sub/1", "bot")
+	require.NotNil(t, rule)
+	assert.False(t, tied)
+	assert.Equal(t, "/page/sub", rule.Path)
+
+	rule, tied = r.MostSpecificRule("/other", "bot")
+	assert.Nil(t, rule)
+	assert.False(t, tied)
+}
+
+func TestSubset(t *testing.T) {
+	t.Parallel()
+	r, err := FromString(robotsText001)
+	require.NoError(t, err)
+	paths := []string{"/", "/administrator/", "/cache/x", "/index.php?option=com_phorum1,older", "/paruram"}
+	for _, agent := range []string{"Yandex", "SomeBot"} {
+		sub := r.Subset(agent)
+		require.Len(t, sub.Groups, 1, agent)
+		assert.Equal(t, r.Sitemaps, sub.Sitemaps)
+		assert.Equal(t, r.FindGroup(agent).CrawlDelay, sub.FindGroup(agent).CrawlDelay)
+		for _, p := range paths {
+			assert.Equal(t, r.TestAgent(p, agent), sub.TestAgent(p, agent), "agent=%s path=%s", agent, p)
+			assert.Equal(t, r.TestAgent(p, agent), sub.TestAgent(p, "other"), "agent=%s path=%s", agent, p)
+		}
+	}
+
+	r, err = FromStatusAndString(503, "")
+	require.NoError(t, err)
+	expectAll(t, r.Subset("bot"), false)
+
+	// The limits and Retry-After apply to the subset too
+	r, err = FromBytesWithOptions([]byte("User-agent: bot\nCrawl-delay: 120\n"), ParseOptions{MaxCrawlDelay: time.Minute})
+	require.NoError(t, err)
+	d, ok := r.Subset("bot").CrawlDelay("bot")
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, d)
+	res := newHttpResponse(503, "")
+	res.Header = http.Header{"Retry-After": {"30"}}
+	r, err = FromResponseWithOptions(res, ParseOptions{MaxCrawlDelay: 10 * time.Second})
+	require.NoError(t, err)
+	d, _ = r.Subset("bot").CrawlDelay("bot")
+	assert.Equal(t, 10*time.Second, d)
+	r, err = FromBytesWithOptions([]byte("User-agent: foo\nDisallow: /\n"), ParseOptions{PrefixAgentMatch: true})
+	require.NoError(t, err)
+	assert.True(t, r.Subset("foobot").prefixAgents)
+	expectAccess(t, r.Subset("foobot"), false, "/", "foobot")
+}
+
+func TestEffectiveGroup(t *testing.T) {
+	t.Parallel()
+	const robotsCaseMerge = `User-agent: *
+Disallow: /private
+Disallow: /shared
+Crawl-delay: 3
+
+User-agent: bot
+Allow: /shared
+Disallow: /bot-only`
+	r, err := FromString(robotsCaseMerge)
+	require.NoError(t, err)
+
+	g := r.EffectiveGroup("bot", false)
+	assert.True(t, r.FindGroup("bot") == g)
+	assert.True(t, g.Test("/private"))
+
+	g = r.EffectiveGroup("bot", true)
+	assert.Equal(t, "bot", g.Agent)
+	assert.Len(t, g.Rules, 4)
+	assert.False(t, g.Test("/private"))
+	assert.False(t, g.Test("/bot-only"))
+	assert.True(t, g.Test("/shared"))
+	assert.Equal(t, 3*time.Second, g.CrawlDelay)
+	assert.Len(t, r.Groups["bot"].Rules, 2)
+
+	assert.True(t, r.Groups["*"] == r.EffectiveGroup("other", true))
+
+	// On a tie the rule of the agent wins, whatever its kind
+	r, err = FromString("User-agent: *\nAllow: /x\nDisallow: /y\n\nUser-agent: bot\nDisallow: /x\nAllow: /y\n")
+	require.NoError(t, err)
+	g = r.EffectiveGroup("bot", true)
+	assert.False(t, g.Test("/x"))
+	assert.True(t, g.Test("/y"))
+	steps := g.trace("/x", g.tie())
+	assert.True(t, steps[0].Winner)
+	assert.False(t, steps[2].Winner)
+	rule, allowed := g.MatchedRule("/x")
+	assert.False(t, allowed)
+	assert.Equal(t, 6, rule.Line)
+}
+
+func TestAddRule(t *testing.T) {
+	t.Parallel()
+	r, err := FromString("User-agent: *\nDisallow: /private\n")
+	require.NoError(t, err)
+	require.NoError(t, r.AddRule("*", "/tmp", false))
+	require.NoError(t, r.AddRule("*", "/private/ok", true))
+	require.NoError(t, r.AddRule("internal", "/*.pdf$", false))
+	expectAccess(t, r, false, "/tmp/x", "bot")
+	expectAccess(t, r, true, "/private/ok/1", "bot")
+	expectAccess(t, r, false, "/private/no", "bot")
+	expectAccess(t, r, true, "/a.pdf", "bot")
+	expectAccess(t, r, false, "/a.pdf", "internal")
+	expectAccess(t, r, true, "/tmp/x", "internal")
+
+	assert.Error(t, r.AddRule("*", "tmp", false))
+	assert.Error(t, r.AddRule("*", "", false))
+}
+
+func TestAddRuleAllowAll(t *testing.T) {
+	t.Parallel()
+	r, err := FromString("")
+	require.NoError(t, err)
+	require.NoError(t, r.AddRule("*", "/tmp", false))
+	expectAccess(t, r, false, "/tmp", "bot")
+	expectAccess(t, r, true, "/", "bot")
+
+	r, err = FromStatusAndString(503, "")
+	require.NoError(t, err)
+	require.NoError(t, r.AddRule("*", "/public", true))
+	expectAccess(t, r, true, "/public", "bot")
+	expectAccess(t, r, false, "/", "bot")
+
+	// Other results are not affected
+	r, err = FromString("")
+	require.NoError(t, err)
+	expectAll(t, r, true)
+}
+
+func TestMaxGroups(t *testing.T) {
+	t.Parallel()
+	const robotsCaseGroups = `User-agent: a
+Disallow: /a
+User-agent: b
+Disallow: /b
+User-agent: c
+Disallow: /c
+User-agent: d
+Disallow: /d
+User-agent: a
+Disallow: /a2`
+	var log testLogger
+	r, err := FromBytesWithOptions([]byte(robotsCaseGroups), ParseOptions{Logger: &log, MaxGroups: 2})
+	require.NoError(t, err)
+	assert.Len(t, r.Groups, 2)
+	expectAccess(t, r, false, "/a2", "a")
+	expectAccess(t, r, false, "/b", "b")
+	expectAccess(t, r, true, "/c", "c")
+	require.Len(t, log.messages, 1)
+	assert.Contains(t, log.messages[0], "more than 2 groups")
+
+	r, err = FromString(robotsCaseGroups)
+	require.NoError(t, err)
+	assert.Len(t, r.Groups, 4)
+}
+
+func TestMaxWildcards(t *testing.T) {
+	t.Parallel()
+	const robotsCaseWildcards = "User-agent: *\nDisallow: /a/*/b/*/c/*/d\nDisallow: /x/*/y\n"
+	var log testLogger
+	r, err := FromBytesWithOptions([]byte(robotsCaseWildcards), ParseOptions{Logger: &log, MaxWildcards: 2})
+	require.NoError(t, err)
+	g := r.FindGroup("bot")
+	require.Len(t, g.Rules, 2)
+	assert.Equal(t, "/a/", g.Rules[0].Path)
+	assert.False(t, g.Rules[0].isPattern())
+	assert.True(t, g.Rules[1].isPattern())
+	expectAccess(t, r, false, "/a/anything", "bot")
+	require.Len(t, log.messages, 1)
+	assert.Contains(t, log.messages[0], "3 wildcards")
+
+	r, err = FromString(robotsCaseWildcards)
+	require.NoError(t, err)
+	expectAccess(t, r, true, "/a/anything", "bot")
+	expectAccess(t, r, false, "/a/1/b/2/c/3/d", "bot")
+
+	// A leading wildcard leaves "/", a "$" before the first wildcard is
+	// literal
+	r, err = FromBytesWithOptions([]byte("User-agent: *\nDisallow: *a*a*a\nDisallow: /p$q/*/*/*x\n"),
+		ParseOptions{MaxWildcards: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Disallow: /", "Disallow: /p$q/"}, ruleStrings(r.FindGroup("bot")))
+	expectAccess(t, r, false, "/anything", "bot")
+}
+
+func TestMaxParseDuration(t *testing.T) {
+	t.Parallel()
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	for i := 0; i < 5000; i++ {
+		fmt.Fprintf(&b, "Disallow: /%d/*/a*b*c*d*e*f*g*h*i*j/*.php$\n", i)
+	}
+	robotsCaseHeavy := []byte(b.String())
+
+	r, err := FromBytesWithOptions(robotsCaseHeavy, ParseOptions{MaxParseDuration: time.Microsecond})
+	assert.Equal(t, ErrParseDeadline, err)
+	assert.Nil(t, r)
+
+	r, err = FromBytesWithOptions(robotsCaseHeavy, ParseOptions{MaxParseDuration: time.Minute})
+	require.NoError(t, err)
+	assert.Len(t, r.FindGroup("bot").Rules, 5000)
+}
+
+func TestMaxAgentLength(t *testing.T) {
+	t.Parallel()
+	long := strings.Repeat("a", 1<<20)
+	var log testLogger
+	r, err := FromBytesWithOptions([]byte("User-agent: "+long+"\nDisallow: /\n"), ParseOptions{Logger: &log, MaxParseBytes: -1})
+	require.NoError(t, err)
+	assert.Empty(t, r.Groups)
+	expectAccess(t, r, true, "/", long[:DefaultMaxAgentLength])
+	require.Len(t, log.messages, 1)
+	assert.Contains(t, log.messages[0], "more than 256")
+	assert.Equal(t, WarnLongAgent, r.Warnings[0].Kind)
+
+	// A cut value would name another crawler
+	r, err = FromBytesWithOptions([]byte("User-agent: googlebot-news\nDisallow: /\n\nUser-agent: *\nDisallow: /private\n"), ParseOptions{MaxAgentLength: 9})
+	require.NoError(t, err)
+	expectAccess(t, r, true, "/", "Googlebot")
+	expectAccess(t, r, false, "/private", "Googlebot")
+
+	// Other agents of the block keep the group, multi-byte values are
+	// measured in bytes
+	r, err = FromBytesWithOptions([]byte("User-agent: bot\u00e9\u00e9\nUser-agent: other\nDisallow: /\n"), ParseOptions{MaxAgentLength: 6})
+	require.NoError(t, err)
+	assert.NotContains(t, r.Groups, "bot\u00e9")
+	expectAccess(t, r, false, "/", "other")
+
+	_, err = FromBytesWithOptions([]byte("User-agent: googlebot-news\nDisallow: /\n"), ParseOptions{Strict: true, MaxAgentLength: 9})
+	require.Error(t, err)
+}
+
+func TestDecodePaths(t *testing.T) {
+	t.Parallel()
+	const robotsCaseEncoded = "User-agent: *\nDisallow: /a%2Fb\nDisallow: /caf%C3%A9\nAllow: /caf%C3%A9/menu\n"
+	r, err := FromBytesWithOptions([]byte(robotsCaseEncoded), ParseOptions{DecodePaths: true})
+	require.NoError(t, err)
+	assert.Equal(t, "/a/b", r.FindGroup("bot").Rules[0].Path)
+	expectAccess(t, r, false, "/a/b", "bot")
+	expectAccess(t, r, false, "/a%2Fb", "bot")
+	expectAccess(t, r, false, "/café", "bot")
+	expectAccess(t, r, false, "/caf%C3%A9", "bot")
+	expectAccess(t, r, true, "/café/menu", "bot")
+	expectAccess(t, r, true, "/100%", "bot")
+	require.NoError(t, r.AddRule("bot", "/x%2Fy", false))
+	expectAccess(t, r, false, "/x%2fy", "bot")
+	expectAccess(t, r, false, "/x/y", "bot")
+
+	// Encoded mode
+	r, err = FromBytesWithOptions([]byte(robotsCaseEncoded), ParseOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "/a%2Fb", r.FindGroup("bot").Rules[0].Path)
+	expectAccess(t, r, true, "/a/b", "bot")
+	expectAccess(t, r, false, "/a%2fb", "bot")
+	expectAccess(t, r, false, "/café", "bot")
+	expectAccess(t, r, false, "/caf%C3%A9", "bot")
+	expectAccess(t, r, true, "/caf%C3%A9/menu", "bot")
+}
+
+func TestNormalizeBackslashes(t *testing.T) {
+	t.Parallel()
+	const robotsCaseBackslash = "User-agent: *\nDisallow: \\admin\\users\n"
+	var log testLogger
+	r, err := FromBytesWithOptions([]byte(robotsCaseBackslash), ParseOptions{Logger: &log, NormalizeBackslashes: true})
+	require.NoError(t, err)
+	assert.Equal(t, "/admin/users", r.FindGroup("bot").Rules[0].Path)
+	expectAccess(t, r, false, "/admin/users/1", "bot")
+	require.Len(t, log.messages, 1)
+	assert.Contains(t, log.messages[0], "backslashes")
+
+	r, err = FromString(robotsCaseBackslash)
+	require.NoError(t, err)
+	expectAccess(t, r, true, "/admin/users/1", "bot")
+
+	r, err = FromBytesWithOptions([]byte(robotsCaseBackslash), ParseOptions{Strict: true, NormalizeBackslashes: true})
+	require.NoError(t, err)
+	assert.Equal(t, `/\admin\users`, r.FindGroup("bot").Rules[0].Path)
+	expectAccess(t, r, true, "/admin/users/1", "bot")
+}
+
+func TestSingleCharWildcard(t *testing.T) {
+	t.Parallel()
+	const robotsCaseSingle = "User-agent: *\nDisallow: /file?.txt\nDisallow: /search?q=\nDisallow: /*?\n"
+	r, err := FromBytesWithOptions([]byte(robotsCaseSingle), ParseOptions{SingleCharWildcard: true})
+	require.NoError(t, err)
+	expectAccess(t, r, false, "/file1.txt", "bot")
+	expectAccess(t, r, true, "/file.txt", "bot")
+	expectAccess(t, r, true, "/file12.txt", "bot")
+	// A "?" starting the query string stays literal
+	expectAccess(t, r, false, "/search?q=go", "bot")
+	expectAccess(t, r, true, "/searchXq=go", "bot")
+	expectAccess(t, r, false, "/page?id=1", "bot")
+	expectAccess(t, r, true, "/page", "bot")
+
+	r, err = FromString(robotsCaseSingle)
+	require.NoError(t, err)
+	expectAccess(t, r, true, "/file1.txt", "bot")
+	expectAccess(t, r, false, "/file?.txt", "bot")
+	expectAccess(t, r, false, "/search?q=go", "bot")
+	expectAccess(t, r, false, "/page?id=1", "bot")
+}
+
+func TestStripHTTPHeaders(t *testing.T) {
+	t.Parallel()
+	const robotsCaseHeaders = "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nX-Cache: HIT\r\n\r\n" +
+		"User-agent: *\nDisallow: /private\n"
+	var log testLogger
+	r, err := FromBytesWithOptions([]byte(robotsCaseHeaders), ParseOptions{Logger: &log, StripHTTPHeaders: true})
+	require.NoError(t, err)
+	expectAccess(t, r, false, "/private", "bot")
+	require.Len(t, r.Groups, 1)
+	assert.Equal(t, 6, r.FindGroup("bot").Rules[0].Line)
+	require.Len(t, log.messages, 1)
+	assert.Contains(t, log.messages[0], "HTTP header")
+	require.Len(t, r.Warnings, 1)
+	assert.Equal(t, WarnHTTPHeaders, r.Warnings[0].Kind)
+
+	// No blank line, only the status line is dropped
+	r, err = FromBytesWithOptions([]byte("HTTP/1.0 200 OK\nUser-agent: *\nDisallow: /private\n"),
+		ParseOptions{StripHTTPHeaders: true})
+	require.NoError(t, err)
+	expectAccess(t, r, false, "/private", "bot")
+	assert.Equal(t, 3, r.FindGroup("bot").Rules[0].Line)
+}
+
+func TestIgnoreAllow(t *testing.T) {
+	t.Parallel()
+	const robotsCaseAllow = "User-agent: *\nDisallow: /\nAllow: /public\nUser-agent: bot\nDisallow: /tmp\n"
+	r, err := FromString(robotsCaseAllow)
+	require.NoError(t, err)
+	expectAccess(t, r, true, "/public/a", "other")
+	expectAccess(t, r, false, "/private", "other")
+	expectAccess(t, r, false, "/tmp", "bot")
+	expectAccess(t, r, true, "/public/a", "bot")
+
+	r, err = FromBytesWithOptions([]byte(robotsCaseAllow), ParseOptions{IgnoreAllow: true})
+	require.NoError(t, err)
+	expectAccess(t, r, false, "/public/a", "other")
+	expectAccess(t, r, false, "/private", "other")
+	// The Allow line still ends the "*" group
+	expectAccess(t, r, false, "/tmp", "bot")
+	expectAccess(t, r, true, "/public/a", "bot")
+}
+
+func TestRejectHTML(t *testing.T) {
+	t.Parallel()
+	const robotsTextRefresh = `<html><head>
+<meta http-equiv="Refresh" content="0; url=https://www.example.com/robots.txt">
+</head></html>`
+	var log testLogger
+	r, err := FromBytesWithOptions([]byte(robotsTextRefresh), ParseOptions{Logger: &log, RejectHTML: true})
+	require.NoError(t, err)
+	assert.True(t, r.AllowAll)
+	require.Len(t, log.messages, 1)
+	assert.Contains(t, log.messages[0], "meta refresh")
+	require.Len(t, r.Warnings, 1)
+	assert.Equal(t, WarnHTML, r.Warnings[0].Kind)
+	assert.Equal(t, "html", r.Warnings[0].Kind.String())
+
+	log.messages = nil
+	r, err = FromBytesWithOptions([]byte(robotsTextJustHTML), ParseOptions{Logger: &log, RejectHTML: true})
+	require.NoError(t, err)
+	assert.True(t, r.AllowAll)
+	require.Len(t, log.messages, 1)
+	assert.NotContains(t, log.messages[0], "meta refresh")
+
+	r, err = FromBytesWithOptions([]byte(robotsTextRefresh), ParseOptions{})
+	require.NoError(t, err)
+	assert.False(t, r.AllowAll)
+	expectAccess(t, r, true, "/", "bot")
+}
+
+func TestCommaSeparatedAgents(t *testing.T) {
+	t.Parallel()
+	const robotsCaseComma = "User-agent: Googlebot, Bingbot\nDisallow: /private\n"
+	var log testLogger
+	r, err := FromBytesWithOptions([]byte(robotsCaseComma), ParseOptions{Logger: &log, Repair: true})
+	require.NoError(t, err)
+	require.Len(t, r.Groups, 2)
+	assert.True(t, r.Groups["googlebot"].Rules[0] == r.Groups["bingbot"].Rules[0])
+	expectAccess(t, r, false, "/private", "Googlebot")
+	expectAccess(t, r, false, "/private", "Bingbot")
+	expectAccess(t, r, true, "/private", "Other")
+	require.Len(t, log.messages, 1)
+	assert.Contains(t, log.messages[0], "comma-separated")
+
+	r, err = FromBytesWithOptions([]byte(robotsCaseComma), ParseOptions{Strict: true})
+	require.NoError(t, err)
+	expectAccess(t, r, true, "/private", "Bingbot")
+	r, err = FromString(robotsCaseComma)
+	require.NoError(t, err)
+	expectAccess(t, r, true, "/private", "Bingbot")
+}
+
+func TestLoggerTruncated(t *testing.T) {
+	t.Parallel()
+	var log testLogger
+	r, err := FromBytesWithOptions([]byte("User-agent: *\nDisallow: /private\nDisall"), ParseOptions{Logger: &log})
+	require.NoError(t, err)
+	expectAccess(t, r, false, "/private", "bot")
+	require.Len(t, log.messages, 1)
+	assert.Contains(t, log.messages[0], "truncated")
+	assert.Contains(t, log.messages[0], `"Disall"`)
+}
+
+func TestLoggerHTML(t *testing.T) {
+	t.Parallel()
+	var log testLogger
+	_, err := FromBytesWithOptions([]byte(robotsTextJustHTML), ParseOptions{Logger: &log})
+	require.NoError(t, err)
+	require.NotEmpty(t, log.messages)
+	assert.Contains(t, log.messages[0], "HTML")
+}
+
 func BenchmarkParseFromString001(b *testing.B) {
 	input := robotsText001
 	b.ReportAllocs()
@@ -254,6 +1476,84 @@ func BenchmarkParseFromString002(b *testing.B) {
 	}
 }
 
+// robotsManyAgents returns a robots.txt with n groups for agents sharing
+// prefixes, like "bot1", "bot1-news", "bot1-news-images".
+func robotsManyAgents(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		name := "bot" + strconv.Itoa(i/3)
+		for j := 0; j < i%3; j++ {
+			name += []string{"-news", "-images"}[j]
+		}
+		fmt.Fprintf(&b, "User-agent: %s\nDisallow: /%d\n\n", name, i)
+	}
+	b.WriteString("User-agent: *\nDisallow: /all\n")
+	return b.String()
+}
+
+var benchAgents = []string{"bot7-news-images/2.0", "bot16", "Bot3-News", "otherbot", "bot1"}
+
+func TestFindGroupIndex(t *testing.T) {
+	t.Parallel()
+	r, err := FromString(robotsManyAgents(50))
+	require.NoError(t, err)
+	require.True(t, r.indexed())
+	agents := append([]string{"", "*", "bot", "bot10-news-images-x"}, benchAgents...)
+	for i := 0; i < 20; i++ {
+		agents = append(agents, "bot"+strconv.Itoa(i)+"-news")
+	}
+	for _, agent := range agents {
+		assert.True(t, r.findGroupScan(strings.ToLower(agent)) == r.FindGroup(agent), agent)
+	}
+
+	// Groups modified directly are still searched
+	r.Groups["newbot"] = &Group{Agent: "newbot", Rules: []*Rule{{Path: "/new"}}}
+	assert.False(t, r.indexed())
+	expectAccess(t, r, false, "/new", "NewBot")
+	require.NoError(t, r.AddRule("newerbot", "/newer", false))
+	expectAccess(t, r, false, "/newer", "newerbot")
+	assert.True(t, r.indexed())
+
+	// Replacing a key keeps the size of Groups, the index then misses
+	for _, prefix := range []bool{false, true} {
+		r, err = FromBytesWithOptions([]byte("User-agent: a\nDisallow: /a\n\nUser-agent: b\nUser-agent: *\nDisallow: /b\n"),
+			ParseOptions{PrefixAgentMatch: prefix})
+		require.NoError(t, err)
+		require.True(t, r.indexed())
+		delete(r.Groups, "a")
+		r.Groups["c"] = &Group{Agent: "c", Rules: []*Rule{{Path: "/c"}}}
+		require.True(t, r.indexed())
+		expectAccess(t, r, true, "/a", "a")
+		expectAccess(t, r, false, "/b", "a")
+		// The index does not know c until it is rebuilt
+		assert.Equal(t, "*", r.FindGroup("c").Agent)
+		r.Compile()
+		assert.Equal(t, "c", r.FindGroup("c").Agent)
+		expectAccess(t, r, false, "/c", "c")
+		delete(r.Groups, "*")
+		r.Groups["d"] = &Group{Agent: "d"}
+		expectAccess(t, r, true, "/b", "other")
+		expectAccess(t, r, false, "/b", "b")
+	}
+}
+
+func BenchmarkFindGroup(b *testing.B) {
+	r, err := FromString(robotsManyAgents(50))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run("scan", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			r.findGroupScan(strings.ToLower(benchAgents[i%len(benchAgents)]))
+		}
+	})
+	b.Run("index", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			r.FindGroup(benchAgents[i%len(benchAgents)])
+		}
+	})
+}
+
 func BenchmarkParseFromStatus401(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		if _, err := FromStatusAndString(401, ""); err != nil {
@@ -281,6 +1581,33 @@ func expectAccess(t *testing.T, r *RobotsData, allow bool, path, agent string) b
 	return assert.Equal(t, allow, r.TestAgent(path, agent), "Path='%s' agent='%s'", path, agent)
 }
 
+// ruleStrings returns the rules of g as written.
+func ruleStrings(g *Group) []string {
+	var rules []string
+	for _, rule := range g.Rules {
+		rules = append(rules, rule.String())
+	}
+	return rules
+}
+
+type testLogger struct {
+	messages []string
+}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, v...))
+}
+
+// newChunkedResponse returns a response whose body, like a chunked one,
+// has no known length and is read a byte at a time.
+func newChunkedResponse(code int, body string) *http.Response {
+	res := newHttpResponse(code, "")
+	res.ContentLength = -1
+	res.TransferEncoding = []string{"chunked"}
+	res.Body = ioutil.NopCloser(iotest.OneByteReader(strings.NewReader(body)))
+	return res
+}
+
 func newHttpResponse(code int, body string) *http.Response {
 	return &http.Response{
 		StatusCode:    code,
@@ -0,0 +1,53 @@
+// Package robotstxttest provides assertions for tests of crawlers built on
+// package robotstxt.
+package robotstxttest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/airplayx/robotstxt"
+)
+
+// AssertAllowed fails t unless r allows agent to fetch path.
+func AssertAllowed(t testing.TB, r *robotstxt.RobotsData, path, agent string) bool {
+	t.Helper()
+	return check(t, r, true, path, agent)
+}
+
+// AssertDisallowed fails t unless r disallows agent to fetch path.
+func AssertDisallowed(t testing.TB, r *robotstxt.RobotsData, path, agent string) bool {
+	t.Helper()
+	return check(t, r, false, path, agent)
+}
+
+func check(t testing.TB, r *robotstxt.RobotsData, allow bool, path, agent string) bool {
+	t.Helper()
+	if r.TestAgent(path, agent) == allow {
+		return true
+	}
+	want := "allowed"
+	if !allow {
+		want = "disallowed"
+	}
+	t.Errorf("expected %q to be %s for agent %q, but %s", path, want, agent, reason(r, path, agent))
+	return false
+}
+
+// reason describes what decided path for agent.
+func reason(r *robotstxt.RobotsData, path, agent string) string {
+	switch {
+	case r.AllowAll:
+		return "everything is allowed"
+	case r.DisallowAll:
+		return "everything is disallowed"
+	}
+	rule, _ := r.MostSpecificRule(path, agent)
+	if rule == nil {
+		return fmt.Sprintf("no rule of group %q matches", r.FindGroup(agent).Agent)
+	}
+	if rule.Line > 0 {
+		return fmt.Sprintf("%q (line %d) of group %q matches", rule.String(), rule.Line, r.FindGroup(agent).Agent)
+	}
+	return fmt.Sprintf("%q of group %q matches", rule.String(), r.FindGroup(agent).Agent)
+}
@@ -0,0 +1,45 @@
+package robotstxttest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/airplayx/robotstxt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder captures failures instead of failing the test.
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssert(t *testing.T) {
+	r, err := robotstxt.FromString("User-agent: *\nDisallow: /private\n\nUser-agent: bot\nDisallow: /bot\n")
+	require.NoError(t, err)
+
+	AssertAllowed(t, r, "/public", "other")
+	AssertDisallowed(t, r, "/private", "other")
+	AssertDisallowed(t, r, "/bot/1", "bot")
+
+	rec := &recorder{TB: t}
+	assert.False(t, AssertAllowed(rec, r, "/private/1", "other"))
+	assert.False(t, AssertDisallowed(rec, r, "/private", "bot"))
+	assert.Equal(t, []string{
+		`expected "/private/1" to be allowed for agent "other", but "Disallow: /private" (line 2) of group "*" matches`,
+		`expected "/private" to be disallowed for agent "bot", but no rule of group "bot" matches`,
+	}, rec.errors)
+
+	r, err = robotstxt.FromStatusAndString(503, "")
+	require.NoError(t, err)
+	rec.errors = nil
+	AssertAllowed(rec, r, "/", "bot")
+	assert.Equal(t, []string{`expected "/" to be allowed for agent "bot", but everything is disallowed`}, rec.errors)
+}
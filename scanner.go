@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"go/token"
 	"os"
+	"strings"
 	"sync"
+	"unicode"
 	"unicode/utf8"
 )
 
@@ -17,6 +19,12 @@ type byteScanner struct {
 	Quiet         bool
 	keyTokenFound bool
 	lastChunk     bool
+	logger        Logger
+	tokLine       int   // Line of the last scanned token
+	lines         []int // Lines of the tokens returned by scanAll
+	unicodeSpace  bool  // Treat Unicode whitespace such as U+00A0 as whitespace
+	warnedLine    int   // Last line a Unicode whitespace was reported on
+	warnings      []Warning
 }
 
 const tokEOL = "\n"
@@ -51,6 +59,18 @@ func (s *byteScanner) feed(input []byte, end bool) {
 	}
 }
 
+// feedMore is feed for the input following that fed before, which ended
+// with a line ending: positions go on from there.
+func (s *byteScanner) feedMore(input []byte, end bool) {
+	s.buf = input
+	s.pos.Offset = 0
+	s.pos.Line++
+	s.pos.Column = 1
+	s.lastChunk = end
+	s.ch = -1
+	s.nextChar()
+}
+
 func (s *byteScanner) GetPosition() token.Position {
 	return s.pos
 }
@@ -66,6 +86,7 @@ func (s *byteScanner) scan() string {
 	if s.ch == -1 {
 		return ""
 	}
+	s.tokLine = s.pos.Line
 
 	// EOL
 	if s.isEol() {
@@ -80,9 +101,11 @@ func (s *byteScanner) scan() string {
 
 	// skip comments
 	if s.ch == '#' {
+		// A comment ending a directive line still ends the line
+		trailing := s.keyTokenFound
 		s.keyTokenFound = false
 		s.skipUntilEol()
-		if s.ch == -1 {
+		if s.ch == -1 && !trailing {
 			return ""
 		}
 		// emit newline as separate token
@@ -97,6 +120,11 @@ func (s *byteScanner) scan() string {
 	s.nextChar()
 	//for s.ch != -1 && !s.isSpace() && !s.isEol() {
 	for s.ch != -1 && !s.isEol() {
+		// A comment may follow a directive on the same line, it is
+		// skipped by the next scan.
+		if s.ch == '#' {
+			break
+		}
 		// Do not consider ":" to be a token separator if a first key token
 		// has already been found on this line (avoid cutting an absolute URL
 		// after the "http:")
@@ -109,7 +137,8 @@ func (s *byteScanner) scan() string {
 		tok.WriteRune(s.ch)
 		s.nextChar()
 	}
-	return tok.String()
+	// Whitespace between the value and the end of line is not part of it.
+	return strings.TrimRightFunc(tok.String(), s.isSpaceRune)
 }
 
 func (s *byteScanner) scanAll() []string {
@@ -118,6 +147,7 @@ func (s *byteScanner) scanAll() []string {
 		theToken := s.scan()
 		if theToken != "" {
 			results = append(results, theToken)
+			s.lines = append(s.lines, s.tokLine)
 		} else {
 			break
 		}
@@ -127,6 +157,9 @@ func (s *byteScanner) scanAll() []string {
 
 func (s *byteScanner) error(pos token.Position, msg string) {
 	s.ErrorCount++
+	if s.logger != nil {
+		s.logger.Printf("robotstxt from %s: %s", pos.String(), msg)
+	}
 	if !s.Quiet {
 		_, _ = fmt.Fprintf(os.Stderr, "robotstxt from %s: %s\n", pos.String(), msg)
 	}
@@ -137,8 +170,33 @@ func (s *byteScanner) isEol() bool {
 }
 
 func (s *byteScanner) isSpace() bool {
+	return s.isSpaceRune(s.ch)
+}
+
+// isSpaceRune reports whether ch separates tokens. Unicode whitespace other
+// than line breaks only does when unicodeSpace is set, and is reported once
+// per line.
+func (s *byteScanner) isSpaceRune(ch rune) bool {
+	if isWhitespace(ch) {
+		return true
+	}
+	if !s.unicodeSpace || ch < utf8.RuneSelf || ch == '\u0085' || ch == '\u2028' || ch == '\u2029' || !unicode.IsSpace(ch) {
+		return false
+	}
+	if s.warnedLine != s.pos.Line {
+		s.warnedLine = s.pos.Line
+		msg := fmt.Sprintf("%U read as whitespace", ch)
+		s.warnings = append(s.warnings, Warning{Line: s.pos.Line, Kind: WarnUnicodeSpace, Message: msg})
+		if s.logger != nil {
+			s.logger.Printf("robotstxt from %s: %s", s.pos.String(), msg)
+		}
+	}
+	return true
+}
+
+func isWhitespace(ch rune) bool {
 	for _, r := range WhitespaceChars {
-		if s.ch == r {
+		if ch == r {
 			return true
 		}
 	}
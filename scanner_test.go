@@ -21,6 +21,9 @@ func TestScanner(t *testing.T) {
 		{"# comment \r\nSomething: Somewhere\r\n", []string{tokEOL, "Something", "Somewhere", tokEOL}, 0},
 		{"# comment \r\n# more comments\n\nDisallow:\r", []string{tokEOL, tokEOL, "Disallow", tokEOL}, 0},
 		{"\xef\xbb\xbfUser-agent: *\n", []string{"User-agent", "*", tokEOL}, 0},
+		{"User-agent: * \t\nDisallow: /a \n", []string{"User-agent", "*", tokEOL, "Disallow", "/a", tokEOL}, 0},
+		{"# see: https://example.com\nDisallow: /a # note: b\n", []string{tokEOL, "Disallow", "/a", tokEOL}, 0},
+		{"Sitemap: https://example.com/s.xml#top\n", []string{"Sitemap", "https://example.com/s.xml", tokEOL}, 0},
 		{"\xd9\xd9", []string{"\uFFFD\uFFFD"}, 2},
 	}
 	for i, c := range cases {
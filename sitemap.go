@@ -0,0 +1,140 @@
+package robotstxt
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+// resolveSitemaps replaces relative sitemap URLs by absolute ones, in place.
+// Entries that are not valid URLs are left untouched.
+func resolveSitemaps(sitemaps []string, base *url.URL) {
+	for i, s := range sitemaps {
+		if u, err := url.Parse(s); err == nil && !u.IsAbs() {
+			sitemaps[i] = base.ResolveReference(u).String()
+		}
+	}
+}
+
+// SitemapURLs returns the Sitemap URLs as parsed URLs, in file order and
+// without repeats. Relative URLs were resolved against the URL robots.txt
+// was fetched from, when known. Scheme and host are lower cased and
+// fragments dropped. Values that are not absolute http or https URLs are
+// left out, they are reported in Warnings.
+func (r *RobotsData) SitemapURLs() []*url.URL {
+	var urls []*url.URL
+	seen := make(map[string]bool, len(r.Sitemaps))
+	for _, s := range r.Sitemaps {
+		u, err := sitemapURL(s)
+		if err != nil || seen[u.String()] {
+			continue
+		}
+		seen[u.String()] = true
+		urls = append(urls, u)
+	}
+	return urls
+}
+
+// sitemapURL parses and normalizes the Sitemap URL s.
+func sitemapURL(s string) (*url.URL, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Host == "" || u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("Sitemap %q is not an absolute http or https URL", s)
+	}
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	return u, nil
+}
+
+// sitemapWarnings returns a warning for each of sitemaps that sitemapURL
+// rejects, lines are their source lines.
+func sitemapWarnings(sitemaps []string, lines []int) []Warning {
+	var warnings []Warning
+	for i, s := range sitemaps {
+		if _, err := sitemapURL(s); err != nil {
+			w := Warning{Kind: WarnInvalidSitemap, Text: "Sitemap: " + s, Message: err.Error()}
+			if i < len(lines) {
+				w.Line = lines[i]
+			}
+			warnings = append(warnings, w)
+		}
+	}
+	return warnings
+}
+
+// LikelySitemapIndexes returns, in file order, the Sitemap URLs whose file
+// name suggests a sitemap index, such as "sitemap_index.xml",
+// "sitemap-index.xml.gz" or "sitemapindex.xml". Indexes list other sitemaps
+// and are worth fetching first. The sitemaps themselves are not fetched.
+func (r *RobotsData) LikelySitemapIndexes() []string {
+	var indexes []string
+	for _, s := range r.Sitemaps {
+		if isSitemapIndex(s) {
+			indexes = append(indexes, s)
+		}
+	}
+	return indexes
+}
+
+func isSitemapIndex(s string) bool {
+	if u, err := url.Parse(s); err == nil {
+		s = u.Path
+	}
+	name := strings.ToLower(path.Base(s))
+	return strings.Contains(name, "sitemap") && strings.Contains(name, "index")
+}
+
+// SitemapOptions controls NormalizeSitemapsWithOptions.
+type SitemapOptions struct {
+	// Sort sorts the sitemaps, otherwise they keep their order.
+	Sort bool
+
+	// CollapseTrailingSlash treats URLs differing only by a trailing "/",
+	// as "https://example.com/sitemap.xml" and
+	// "https://example.com/sitemap.xml/", as repeated, keeping the first.
+	CollapseTrailingSlash bool
+
+	// Logger is told about collapsed URLs. Nil disables logging.
+	Logger Logger
+}
+
+// NormalizeSitemaps cleans up r.Sitemaps in place: URLs that are not
+// absolute http or https URLs are dropped, as are repeated ones. The
+// remaining URLs keep their order unless sorted is set.
+func (r *RobotsData) NormalizeSitemaps(sorted bool) {
+	r.NormalizeSitemapsWithOptions(SitemapOptions{Sort: sorted})
+}
+
+// NormalizeSitemapsWithOptions is NormalizeSitemaps with explicit options.
+func (r *RobotsData) NormalizeSitemapsWithOptions(opts SitemapOptions) {
+	seen := make(map[string]string, len(r.Sitemaps))
+	kept := r.Sitemaps[:0]
+	for _, s := range r.Sitemaps {
+		u, err := url.Parse(s)
+		if err != nil || u.Host == "" || u.Scheme != "http" && u.Scheme != "https" {
+			continue
+		}
+		key := s
+		if opts.CollapseTrailingSlash {
+			key = strings.TrimRight(s, "/")
+		}
+		if first, ok := seen[key]; ok {
+			if first != s && opts.Logger != nil {
+				opts.Logger.Printf("robotstxt: sitemap %s is the same as %s, dropping it", s, first)
+			}
+			continue
+		}
+		seen[key] = s
+		kept = append(kept, s)
+	}
+	r.Sitemaps = kept
+	if opts.Sort {
+		sort.Strings(r.Sitemaps)
+	}
+}
@@ -0,0 +1,161 @@
+package robotstxt
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const robotsCaseRelativeSitemaps = `Sitemap: /sitemap.xml
+Sitemap: news/sitemap.xml
+Sitemap: https://cdn.example.org/sitemap.xml`
+
+func TestFromBytesBase(t *testing.T) {
+	t.Parallel()
+	base, err := url.Parse("https://example.com/robots.txt")
+	require.NoError(t, err)
+	r, err := FromBytesBase([]byte(robotsCaseRelativeSitemaps), base)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"https://example.com/sitemap.xml",
+		"https://example.com/news/sitemap.xml",
+		"https://cdn.example.org/sitemap.xml",
+	}, r.Sitemaps)
+
+	r, err = FromString(robotsCaseRelativeSitemaps)
+	require.NoError(t, err)
+	assert.Equal(t, "/sitemap.xml", r.Sitemaps[0])
+}
+
+func TestFromResponseBase(t *testing.T) {
+	t.Parallel()
+	res := newHttpResponse(200, robotsCaseRelativeSitemaps)
+	res.Request, _ = http.NewRequest("GET", "http://example.com/robots.txt", nil)
+	r, err := FromResponse(res)
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com/sitemap.xml", r.Sitemaps[0])
+}
+
+func TestLikelySitemapIndexes(t *testing.T) {
+	t.Parallel()
+	r, err := FromString(`Sitemap: https://example.com/sitemap_index.xml
+Sitemap: https://example.com/sitemap.xml
+Sitemap: https://example.com/news/Sitemap-Index.xml.gz
+Sitemap: https://example.com/sitemapindex?page=2
+Sitemap: https://example.com/index/sitemap-posts.xml
+Sitemap: https://example.com/sitemaps/products.xml`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"https://example.com/sitemap_index.xml",
+		"https://example.com/news/Sitemap-Index.xml.gz",
+		"https://example.com/sitemapindex?page=2",
+	}, r.LikelySitemapIndexes())
+
+	r, err = FromString("Sitemap: https://example.com/sitemap.xml")
+	require.NoError(t, err)
+	assert.Empty(t, r.LikelySitemapIndexes())
+}
+
+func TestNormalizeSitemaps(t *testing.T) {
+	t.Parallel()
+	const robotsCaseMessySitemaps = `Sitemap: https://example.com/b.xml
+Sitemap: /relative.xml
+Sitemap: https://example.com/a.xml
+Sitemap: ftp://example.com/c.xml
+Sitemap: https://example.com/b.xml
+Sitemap: http://[::1
+Sitemap: http://example.com/c.xml`
+	r, err := FromString(robotsCaseMessySitemaps)
+	require.NoError(t, err)
+	r.NormalizeSitemaps(false)
+	assert.Equal(t, []string{
+		"https://example.com/b.xml",
+		"https://example.com/a.xml",
+		"http://example.com/c.xml",
+	}, r.Sitemaps)
+
+	r, err = FromString(robotsCaseMessySitemaps)
+	require.NoError(t, err)
+	r.NormalizeSitemaps(true)
+	assert.Equal(t, []string{
+		"http://example.com/c.xml",
+		"https://example.com/a.xml",
+		"https://example.com/b.xml",
+	}, r.Sitemaps)
+}
+
+func TestNormalizeSitemapsTrailingSlash(t *testing.T) {
+	t.Parallel()
+	const robotsCaseSlashSitemaps = `Sitemap: https://example.com/sitemap.xml
+Sitemap: https://example.com/sitemap.xml/
+Sitemap: https://example.com/news/
+Sitemap: https://example.com/news
+Sitemap: https://example.com/sitemap.xml`
+	r, err := FromString(robotsCaseSlashSitemaps)
+	require.NoError(t, err)
+	var log testLogger
+	r.NormalizeSitemapsWithOptions(SitemapOptions{CollapseTrailingSlash: true, Logger: &log})
+	assert.Equal(t, []string{
+		"https://example.com/sitemap.xml",
+		"https://example.com/news/",
+	}, r.Sitemaps)
+	require.Len(t, log.messages, 2)
+	assert.Contains(t, log.messages[0], "https://example.com/sitemap.xml/ is the same as https://example.com/sitemap.xml")
+
+	r, err = FromString(robotsCaseSlashSitemaps)
+	require.NoError(t, err)
+	r.NormalizeSitemaps(false)
+	assert.Len(t, r.Sitemaps, 4)
+}
+
+func TestSitemapOnly(t *testing.T) {
+	t.Parallel()
+	for _, input := range []string{
+		"Sitemap: https://example.com/sitemap.xml",
+		"# sitemaps only\n\nSitemap: https://example.com/sitemap.xml\n",
+	} {
+		r, err := FromString(input)
+		require.NoError(t, err)
+		assert.Empty(t, r.Groups)
+		assert.Equal(t, []string{"https://example.com/sitemap.xml"}, r.Sitemaps)
+		expectAll(t, r, true)
+		assert.True(t, r.AllowAllAgents())
+	}
+}
+
+func TestSitemapURLs(t *testing.T) {
+	t.Parallel()
+	const robotsCaseSitemaps = `Sitemap: https://example.com/a.xml
+Sitemap: /relative.xml
+Sitemap: HTTPS://Example.COM/a.xml#top
+Sitemap: ftp://example.com/c.xml
+Sitemap: http://%zz/bad.xml
+User-agent: *
+Disallow: /private
+Sitemap: https://example.com/b.xml
+`
+	base, err := url.Parse("https://example.com/robots.txt")
+	require.NoError(t, err)
+	r, err := FromBytesBase([]byte(robotsCaseSitemaps), base)
+	require.NoError(t, err)
+	var urls []string
+	for _, u := range r.SitemapURLs() {
+		urls = append(urls, u.String())
+	}
+	assert.Equal(t, []string{"https://example.com/a.xml", "https://example.com/relative.xml", "https://example.com/b.xml"}, urls)
+	// Sitemaps is kept as written
+	assert.Len(t, r.Sitemaps, 6)
+	require.Len(t, r.Warnings, 2)
+	assert.Equal(t, 4, r.Warnings[0].Line)
+	assert.Contains(t, r.Warnings[0].Message, "ftp://example.com/c.xml")
+	assert.Equal(t, 5, r.Warnings[1].Line)
+
+	// Without a base relative URLs cannot be resolved
+	r, err = FromString(robotsCaseSitemaps)
+	require.NoError(t, err)
+	assert.Len(t, r.SitemapURLs(), 2)
+	assert.Len(t, r.Warnings, 3)
+}
@@ -0,0 +1,166 @@
+package robotstxt
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Issue is a problem found by Validate. Issues do not make the data
+// unusable, they point at rules that probably do not do what the author
+// intended.
+type Issue struct {
+	Agent   string // Agent of the group the rule belongs to
+	Line    int    // Source line of the rule, zero if unknown
+	Message string
+}
+
+func (i Issue) String() string {
+	if i.Line == 0 {
+		return i.Message
+	}
+	return fmt.Sprintf("line %d: %s", i.Line, i.Message)
+}
+
+// Validate reports rules that can never decide the outcome for any path
+// because another rule of the same group always takes precedence over them,
+// Disallow rules naming robots.txt itself, which crawlers ignore, and groups
+// that could be removed because the "*" group they would fall back to has
+// the same crawl delay and rules. Issues are ordered by source line.
+func (r *RobotsData) Validate() []Issue {
+	var issues []Issue
+	// A rule listed for several agents is shared by their groups, report it once.
+	seen := make(map[*Rule]bool)
+	for _, agent := range r.agentNames() {
+		g := r.Groups[agent]
+		for _, rule := range g.Rules {
+			if seen[rule] {
+				continue
+			}
+			seen[rule] = true
+			if by := g.shadowedBy(rule); by != nil {
+				issues = append(issues, Issue{
+					Agent:   agent,
+					Line:    rule.Line,
+					Message: fmt.Sprintf("%s is never used, %s always takes precedence", rule, by),
+				})
+			}
+			if rule.selfReference() {
+				issues = append(issues, Issue{
+					Agent:   agent,
+					Line:    rule.Line,
+					Message: fmt.Sprintf("%s has no effect, crawlers always fetch /robots.txt", rule),
+				})
+			}
+		}
+		if r.redundant(agent) {
+			var line int
+			if len(g.Rules) > 0 {
+				line = g.Rules[0].Line
+			}
+			issues = append(issues, Issue{
+				Agent:   agent,
+				Line:    line,
+				Message: fmt.Sprintf("group %s has the same rules as *, it can be removed", g.Agent),
+			})
+		}
+	}
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Line < issues[j].Line })
+	return issues
+}
+
+// shadowedBy returns the rule that wins over rule on every path rule matches,
+// or nil if there is no such rule.
+//
+// A literal rule matches its path and every extension of it. Wildcards only
+// match more, never less, when a path is extended, and the precedence of a
+// rule does not depend on the path. So if another rule without an end anchor
+// beats rule on its path, it beats rule on every longer path as well. The
+// paths matched by a rule with wildcards have no such shortest one, it is
+// only reported when a rule with the same path wins the tie against it.
+func (g *Group) shadowedBy(rule *Rule) *Rule {
+	if rule.isPattern() || strings.ContainsAny(rule.Path, "*$") {
+		var by *Rule
+		var best int
+		tie := g.tie()
+		for _, r := range g.Rules {
+			if r.Path == rule.Path && tie.wins(r, 1, by, best) {
+				by, best = r, 1
+			}
+		}
+		if by == rule {
+			return nil
+		}
+		return by
+	}
+	path := rule.Path
+	if path == "" {
+		path = "/"
+	}
+	if by := g.findRule(path); by != nil && by != rule && !strings.HasSuffix(by.Path, "$") {
+		return by
+	}
+	return nil
+}
+
+// redundant reports whether the group of agent, a key of Groups, has the
+// same members as the "*" group that would apply to agent without it.
+func (r *RobotsData) redundant(agent string) bool {
+	star := r.Groups["*"]
+	if agent == "*" || star == nil {
+		return false
+	}
+	for a := range r.Groups {
+		if a != agent && a != "*" && r.agentRank(agent, a) > 0 {
+			// Another group would apply
+			return false
+		}
+	}
+	g := r.Groups[agent]
+	return g.CrawlDelay == star.CrawlDelay && sameRules(g.Rules, star.Rules)
+}
+
+// sameRules reports whether a and b hold the same rules, in any order and
+// ignoring repeated ones.
+func sameRules(a, b []*Rule) bool {
+	set := func(rules []*Rule) map[Rule]bool {
+		m := make(map[Rule]bool, len(rules))
+		for _, r := range rules {
+			m[Rule{Path: r.Path, Allow: r.Allow}] = true
+		}
+		return m
+	}
+	sa, sb := set(a), set(b)
+	if len(sa) != len(sb) {
+		return false
+	}
+	for r := range sa {
+		if !sb[r] {
+			return false
+		}
+	}
+	return true
+}
+
+// selfReference reports whether r is a Disallow rule written for
+// /robots.txt. Rules merely covering it, such as "Disallow: /", are fine.
+func (r *Rule) selfReference() bool {
+	return !r.Allow && strings.Contains(r.Path, "robots.txt") && r.specificity("/robots.txt") > 0
+}
+
+// agentNames returns the keys of Groups in sorted order.
+func (r *RobotsData) agentNames() []string {
+	agents := make([]string, 0, len(r.Groups))
+	for a := range r.Groups {
+		agents = append(agents, a)
+	}
+	sort.Strings(agents)
+	return agents
+}
+
+func (r *Rule) String() string {
+	if r.Allow {
+		return "Allow: " + r.Path
+	}
+	return "Disallow: " + r.Path
+}
@@ -0,0 +1,106 @@
+package robotstxt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateShadowed(t *testing.T) {
+	t.Parallel()
+	const robotsCaseShadow = `User-agent: *
+Allow: /shop
+Disallow: /shop
+Disallow: /cart
+Allow: /cart/public
+
+User-agent: a
+User-agent: b
+Allow: /*.html
+Disallow: /*.html
+`
+	r, err := FromString(robotsCaseShadow)
+	require.NoError(t, err)
+	issues := r.Validate()
+	require.Len(t, issues, 2)
+	assert.Equal(t, "*", issues[0].Agent)
+	assert.Equal(t, 3, issues[0].Line)
+	assert.Equal(t, "line 3: Disallow: /shop is never used, Allow: /shop always takes precedence", issues[0].String())
+	assert.Equal(t, "a", issues[1].Agent)
+	assert.Equal(t, 10, issues[1].Line)
+}
+
+func TestValidateClean(t *testing.T) {
+	t.Parallel()
+	r, err := FromString(robotsGoogle)
+	require.NoError(t, err)
+	assert.Empty(t, r.Validate())
+}
+
+func TestValidateSelfReference(t *testing.T) {
+	t.Parallel()
+	r, err := FromString("User-agent: *\nDisallow: /\nDisallow: /robots.txt\nDisallow: /*robots.txt$\nDisallow: /old/robots.txt\nAllow: /robots.txt\n")
+	require.NoError(t, err)
+	issues := r.Validate()
+	var self []int
+	for _, i := range issues {
+		if strings.Contains(i.Message, "always fetch /robots.txt") {
+			self = append(self, i.Line)
+		}
+	}
+	assert.Equal(t, []int{3, 4}, self)
+}
+
+func TestValidateRedundantGroup(t *testing.T) {
+	t.Parallel()
+	const robotsCaseRedundant = `User-agent: *
+Disallow: /private
+Allow: /private/public
+
+User-agent: a
+Allow: /private/public
+Disallow: /private
+Allow: /private/public
+
+User-agent: b
+Disallow: /private
+
+User-agent: googlebot
+Disallow: /
+
+User-agent: googlebot-news
+Disallow: /private
+Allow: /private/public
+`
+	r, err := FromString(robotsCaseRedundant)
+	require.NoError(t, err)
+	// The repeated rule of a is reported as well
+	issues := r.Validate()
+	require.Len(t, issues, 3)
+	assert.Equal(t, "a", issues[0].Agent)
+	assert.Equal(t, "line 6: group a has the same rules as *, it can be removed", issues[0].String())
+	// googlebot does not apply to googlebot-news, a different product token
+	assert.Equal(t, "googlebot-news", issues[2].Agent)
+
+	// Unless agents are matched by prefix
+	r, err = FromBytesWithOptions([]byte(robotsCaseRedundant), ParseOptions{PrefixAgentMatch: true})
+	require.NoError(t, err)
+	assert.Len(t, r.Validate(), 2)
+
+	// Crawl delays have to match as well
+	r, err = FromString("User-agent: *\nDisallow: /x\n\nUser-agent: a\nCrawl-delay: 1\nDisallow: /x\n")
+	require.NoError(t, err)
+	assert.Empty(t, r.Validate())
+}
+
+func TestValidateShadowedPattern(t *testing.T) {
+	t.Parallel()
+	// The Allow rule wins on "/ac" but does not match "/abc"
+	r, err := FromString("User-agent: *\nDisallow: /a*c\nAllow: /*ac\n")
+	require.NoError(t, err)
+	assert.Empty(t, r.Validate())
+	expectAccess(t, r, false, "/abc", "bot")
+	expectAccess(t, r, true, "/ac", "bot")
+}
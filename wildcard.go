@@ -0,0 +1,63 @@
+package robotstxt
+
+import "strings"
+
+// wildcard matches rule paths using "*", any sequence of characters, and a
+// final "$", the end of the path, from the start of the path. It is much
+// cheaper to build and run than the equivalent regexp.
+type wildcard struct {
+	parts    []string // Literal text between the "*"
+	anchored bool     // The path ended with "$"
+}
+
+// newWildcard returns the matcher for the rule path pattern.
+func newWildcard(pattern string) *wildcard {
+	w := &wildcard{}
+	if strings.HasSuffix(pattern, "$") {
+		w.anchored = true
+		pattern = pattern[:len(pattern)-1]
+	}
+	w.parts = strings.Split(pattern, "*")
+	return w
+}
+
+// match reports whether w matches path. Matching each part at its leftmost
+// position is enough: it leaves the most room to the parts after it.
+func (w *wildcard) match(path string) bool {
+	first, last := w.parts[0], w.parts[len(w.parts)-1]
+	if !strings.HasPrefix(path, first) {
+		return false
+	}
+	if len(w.parts) == 1 {
+		return !w.anchored || len(path) == len(first)
+	}
+	path = path[len(first):]
+	for _, part := range w.parts[1 : len(w.parts)-1] {
+		i := strings.Index(path, part)
+		if i < 0 {
+			return false
+		}
+		path = path[i+len(part):]
+	}
+	if w.anchored {
+		return strings.HasSuffix(path, last)
+	}
+	return strings.Contains(path, last)
+}
+
+// isPattern reports whether r has wildcards, matched by r.matches rather
+// than as a prefix.
+func (r *Rule) isPattern() bool {
+	return r.wild != nil || r.Pattern != nil
+}
+
+// matches reports whether r matches path, ignoring its precedence.
+func (r *Rule) matches(path string) bool {
+	switch {
+	case r.wild != nil:
+		return r.wild.match(path)
+	case r.Pattern != nil:
+		return r.Pattern.MatchString(path)
+	}
+	return strings.HasPrefix(path, r.Path)
+}
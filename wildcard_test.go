@@ -0,0 +1,130 @@
+package robotstxt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWildcardMatch(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"/fish*", "/fish", true},
+		{"/fish*", "/fish.html", true},
+		{"/fish*", "/Fish.asp", false},
+		{"/*.php", "/index.php", true},
+		{"/*.php", "/filename.php/", true},
+		{"/*.php", "/folder/filename.php?parameters", true},
+		{"/*.php", "/windows.PHP", false},
+		{"/*.php$", "/filename.php", true},
+		{"/*.php$", "/filename.php?parameters", false},
+		{"/*.php$", "/filename.php5", false},
+		{"/fish*.php", "/fish.php", true},
+		{"/fish*.php", "/fishheads/catfish.php?parameters", true},
+		{"/fish*.php", "/Fish.PHP", false},
+		{"/a*b*c", "/abc", true},
+		{"/a*b*c", "/aXbYc/d", true},
+		{"/a*b*c", "/acb", false},
+		{"/a*b*c$", "/abcbc", true},
+		{"/a*b*c$", "/abcb", false},
+		{"/a**b", "/ab", true},
+		{"/$", "/", true},
+		{"/$", "/a", false},
+		{"*/x", "/a/x", true},
+		{"/*", "/", true},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.match, newWildcard(c.pattern).match(c.path), "%s on %s", c.pattern, c.path)
+		assert.Equal(t, c.match, googleMatch(c.path, c.pattern), "google %s on %s", c.pattern, c.path)
+	}
+}
+
+func TestCompilePatterns(t *testing.T) {
+	t.Parallel()
+	const robotsCasePatterns = "User-agent: *\nDisallow: /a*b$\nDisallow: /c$d\nDisallow: /e\n"
+	r, err := FromString(robotsCasePatterns)
+	require.NoError(t, err)
+	rules := r.Groups["*"].Rules
+	for _, rule := range rules {
+		assert.Nil(t, rule.Pattern, rule.Path)
+	}
+	assert.True(t, rules[0].isPattern())
+	// A "$" not ending the path is literal
+	assert.False(t, rules[1].isPattern())
+	expectAccess(t, r, false, "/c$d/e", "bot")
+
+	r, err = FromBytesWithOptions([]byte(robotsCasePatterns), ParseOptions{CompilePatterns: true})
+	require.NoError(t, err)
+	rules = r.Groups["*"].Rules
+	require.NotNil(t, rules[0].Pattern)
+	assert.Equal(t, `^/a.*b$`, rules[0].Pattern.String())
+	assert.Nil(t, rules[1].Pattern)
+	assert.Nil(t, rules[2].Pattern)
+	expectAccess(t, r, false, "/axb", "bot")
+	expectAccess(t, r, true, "/axbc", "bot")
+
+	// "?" wildcards need a regexp
+	r, err = FromBytesWithOptions([]byte("User-agent: *\nDisallow: /a?c\n"), ParseOptions{SingleCharWildcard: true})
+	require.NoError(t, err)
+	assert.NotNil(t, r.Groups["*"].Rules[0].Pattern)
+	expectAccess(t, r, false, "/abc", "bot")
+}
+
+// robotsManyPatterns returns a robots.txt with n wildcard rules.
+func robotsManyPatterns(n int) string {
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	for i := 0; i < n; i++ {
+		b.WriteString("Disallow: /*/private")
+		b.WriteString(strings.Repeat("x", i%7))
+		b.WriteString("/*.json$\n")
+	}
+	return b.String()
+}
+
+func BenchmarkParsePatterns(b *testing.B) {
+	input := []byte(robotsManyPatterns(200))
+	for _, bc := range []struct {
+		name string
+		opts ParseOptions
+	}{
+		{"wildcard", ParseOptions{}},
+		{"regexp", ParseOptions{CompilePatterns: true}},
+	} {
+		bc := bc
+		b.Run(bc.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(input)))
+			for i := 0; i < b.N; i++ {
+				if _, err := FromBytesWithOptions(input, bc.opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMatchPatterns(b *testing.B) {
+	r, err := FromBytesWithOptions([]byte(robotsManyPatterns(200)), ParseOptions{CompilePatterns: true})
+	if err != nil {
+		b.Fatal(err)
+	}
+	rules := r.Groups["*"].Rules
+	const path = "/users/42/privatexxx/settings/profile.json"
+	b.Run("wildcard", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			rules[i%len(rules)].wild.match(path)
+		}
+	})
+	b.Run("regexp", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			rules[i%len(rules)].Pattern.MatchString(path)
+		}
+	})
+}